@@ -2,10 +2,14 @@
 package inmemory
 
 import (
+	"context"
 	"errors"
 	"log"
 	"sync"
+	"time"
 
+	"github.com/genkami/kiara/adapter/internal/adapterstats"
+	"github.com/genkami/kiara/internal/glob"
 	"github.com/genkami/kiara/types"
 )
 
@@ -14,10 +18,13 @@ var (
 	ErrNotSubscribed     = errors.New("not subscribed")
 )
 
+// This is the interval of checking whether types.Pipe.Publish becomes empty while draining.
+var drainPollInterval = 10 * time.Millisecond
+
 // Broker is a simple message broker.
 type Broker struct {
 	lock     sync.RWMutex
-	messages chan *types.Message
+	messages chan *notice
 	adapters adapterSet
 	opts     brokerOptions
 	done     chan struct{}
@@ -28,7 +35,7 @@ func NewBroker() *Broker {
 	opts := defaultBrokerOptions()
 	b := &Broker{
 		adapters: newAdapterSet(),
-		messages: make(chan *types.Message, opts.messagesChSize),
+		messages: make(chan *notice, opts.messagesChSize),
 		opts:     opts,
 		done:     make(chan struct{}),
 	}
@@ -41,20 +48,43 @@ func (b *Broker) run() {
 		select {
 		case <-b.done:
 			return
-		case msg := <-b.messages:
-			b.send(msg)
+		case n := <-b.messages:
+			if n.barrier != nil {
+				b.sendBarrier(n)
+			} else {
+				b.send(n)
+			}
 		}
 	}
 }
 
-func (b *Broker) send(msg *types.Message) {
+func (b *Broker) send(n *notice) {
 	b.lock.RLock()
 	defer b.lock.RUnlock()
 	b.adapters.ForEach(func(a *Adapter) {
-		a.noticed <- msg
+		select {
+		case a.noticed <- n:
+		case <-a.done:
+			// The adapter is stopping.
+		}
 	})
 }
 
+// sendBarrier sends a barrier back to the adapter that sent it.
+func (b *Broker) sendBarrier(n *notice) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.adapters.Has(n.from) {
+		select {
+		case n.from.noticed <- n:
+		case <-n.from.done:
+			// The adapter is stopping.
+		}
+	} else {
+		close(n.barrier)
+	}
+}
+
 func (b *Broker) registerAdapter(a *Adapter) {
 	b.lock.Lock()
 	defer b.lock.Unlock()
@@ -78,6 +108,16 @@ func (b *Broker) Close() {
 	close(b.done)
 }
 
+// notice is an item that is sent through Broker.
+// It is either a message or a barrier, which is used to wait until all messages sent before it are delivered.
+type notice struct {
+	msg *types.Message
+
+	// barrier is closed when the barrier comes back to the adapter `from`.
+	barrier chan struct{}
+	from    *Adapter
+}
+
 // brokerOptions is a configuration of Broker.
 type brokerOptions struct {
 	messagesChSize int
@@ -119,25 +159,36 @@ func (set adapterSet) ForEach(fn func(*Adapter)) {
 
 // Adapter is an adapter that sends messages through Broker.
 type Adapter struct {
-	broker  *Broker
-	subLock sync.RWMutex
-	topics  topicSet
-	pipe    *types.Pipe
-	noticed chan *types.Message
-	done    chan struct{}
-	opts    adapterOptions
+	broker   *Broker
+	subLock  sync.RWMutex
+	topics   topicSet
+	patterns topicSet
+	pipe     *types.Pipe
+	noticed  chan *notice
+	tasks    chan func()
+	done     chan struct{}
+	stats    *adapterstats.Counters
+	opts     adapterOptions
 }
 
-var _ types.Adapter = &Adapter{}
+var (
+	_ types.PatternAdapter = &Adapter{}
+	_ types.DrainAdapter   = &Adapter{}
+	_ types.StatsAdapter   = &Adapter{}
+	_ types.BatchAdapter   = &Adapter{}
+)
 
 func NewAdapter(broker *Broker) *Adapter {
 	opts := defaultAdapterOptions()
 	a := &Adapter{
-		broker:  broker,
-		topics:  newTopicSet(),
-		noticed: make(chan *types.Message, opts.noticedChSize),
-		done:    make(chan struct{}),
-		opts:    opts,
+		broker:   broker,
+		topics:   newTopicSet(),
+		patterns: newTopicSet(),
+		noticed:  make(chan *notice, opts.noticedChSize),
+		tasks:    make(chan func()),
+		done:     make(chan struct{}),
+		stats:    &adapterstats.Counters{},
+		opts:     opts,
 	}
 	return a
 }
@@ -153,21 +204,113 @@ func (a *Adapter) run() {
 		select {
 		case <-a.done:
 			return
-		case msg := <-a.noticed:
-			a.deliver(msg)
+		case n := <-a.noticed:
+			a.handleNotice(n)
 		case msg := <-a.pipe.Publish:
-			a.broker.messages <- msg
+			a.publish(msg)
+		case msgs := <-a.pipe.PublishBatch:
+			for _, msg := range msgs {
+				a.publish(msg)
+			}
+		case task := <-a.tasks:
+			task()
+		}
+	}
+}
+
+func (a *Adapter) publish(msg *types.Message) {
+	if msg.Expired(time.Now()) {
+		a.stats.Expired()
+		msg.Complete(types.ErrExpired)
+		return
+	}
+	// Subscribers must not see the publisher's Result.
+	published := *msg
+	published.Result = nil
+	a.sendToBroker(&notice{msg: &published})
+	a.stats.Published(nil)
+	msg.Complete(nil)
+}
+
+// sendToBroker sends a notice to the broker.
+// It keeps handling notices from the broker while waiting, because the broker may be waiting for this adapter
+// to receive a notice at the same time.
+func (a *Adapter) sendToBroker(n *notice) {
+	for {
+		select {
+		case a.broker.messages <- n:
+			return
+		case received := <-a.noticed:
+			a.handleNotice(received)
+		case <-a.done:
+			return
+		}
+	}
+}
+
+func (a *Adapter) handleNotice(n *notice) {
+	if n.barrier != nil {
+		close(n.barrier)
+	} else {
+		a.deliver(n.msg)
+	}
+}
+
+// Drain waits until all messages remaining in types.Pipe.Publish and types.Pipe.PublishBatch are published, and then waits until the broker finishes
+// dispatching them and this adapter sends all messages that have arrived so far to types.Pipe.Delivered.
+func (a *Adapter) Drain(ctx context.Context) error {
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for len(a.pipe.Publish) > 0 || len(a.pipe.PublishBatch) > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
 		}
 	}
+	// Messages are published one by one in `run`, so the barrier is sent after all messages are published.
+	barrier := make(chan struct{})
+	task := func() {
+		a.sendToBroker(&notice{barrier: barrier, from: a})
+	}
+	select {
+	case a.tasks <- task:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-barrier:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (a *Adapter) deliver(msg *types.Message) {
+	if msg.Expired(time.Now()) {
+		a.stats.Expired()
+		return
+	}
 	a.subLock.RLock()
+	var deliveries []*types.Message
 	if a.topics.Has(msg.Topic) {
-		a.subLock.RUnlock()
-		a.pipe.Delivered <- msg
-	} else {
-		a.subLock.RUnlock()
+		deliveries = append(deliveries, msg)
+	}
+	a.patterns.ForEach(func(pattern string) {
+		if glob.Match(pattern, msg.Topic) {
+			matched := *msg
+			matched.Pattern = pattern
+			deliveries = append(deliveries, &matched)
+		}
+	})
+	a.subLock.RUnlock()
+	for _, m := range deliveries {
+		select {
+		case a.pipe.Delivered <- m:
+			a.stats.Delivered()
+		case <-a.done:
+			return
+		}
 	}
 }
 
@@ -191,9 +334,45 @@ func (a *Adapter) Unsubscribe(topic string) error {
 	return nil
 }
 
+// SubscribePattern subscribes topics that match the given glob-style pattern.
+// The syntax of patterns is the same as Redis: `*` matches any sequence of characters, `?` matches any single character,
+// `[abc]`, `[^abc]` and `[a-z]` match a character in (or not in) a set, and `\` escapes the succeeding character.
+func (a *Adapter) SubscribePattern(pattern string) error {
+	a.subLock.Lock()
+	defer a.subLock.Unlock()
+	if a.patterns.Has(pattern) {
+		return ErrAlreadySubscribed
+	}
+	a.patterns.Add(pattern)
+	return nil
+}
+
+func (a *Adapter) UnsubscribePattern(pattern string) error {
+	a.subLock.Lock()
+	defer a.subLock.Unlock()
+	if !a.patterns.Has(pattern) {
+		return ErrNotSubscribed
+	}
+	a.patterns.Delete(pattern)
+	return nil
+}
+
+// MaxBatchSize returns 0 because this adapter does not limit the size of batches.
+// Messages in a batch are sent to the broker one by one anyway.
+func (a *Adapter) MaxBatchSize() int {
+	return 0
+}
+
+// Stats returns statistics of messages that this adapter handled.
+// Messages are never dropped by this adapter.
+func (a *Adapter) Stats() types.AdapterStats {
+	return a.stats.Snapshot()
+}
+
 func (a *Adapter) Stop() {
-	a.broker.unregisterAdapter(a)
+	// `done` must be closed first so that the broker does not wait for this adapter while holding its lock.
 	close(a.done)
+	a.broker.unregisterAdapter(a)
 }
 
 // adapterOptions is a configuration of Adapter.
@@ -227,3 +406,9 @@ func (set topicSet) Has(topic string) bool {
 	_, ok := set[topic]
 	return ok
 }
+
+func (set topicSet) ForEach(fn func(string)) {
+	for topic := range set {
+		fn(topic)
+	}
+}
@@ -26,4 +26,8 @@ func (e *env) NewAdapter() types.Adapter {
 
 var _ = Describe("Inmemory", func() {
 	commontest.AssertAdapterIsImplementedCorrectly(&env{})
+	commontest.AssertDrainAdapterIsImplementedCorrectly(&env{})
+	commontest.AssertStatsAdapterIsImplementedCorrectly(&env{})
+	commontest.AssertBatchAdapterIsImplementedCorrectly(&env{})
+	commontest.AssertPatternAdapterIsImplementedCorrectly(&env{}, "kfp:*", "kfp:employees", "holox:employees")
 })
@@ -0,0 +1,62 @@
+// Package adapterstats provides counters that adapters use to implement types.StatsAdapter.
+package adapterstats
+
+import (
+	"sync/atomic"
+
+	"github.com/genkami/kiara/types"
+)
+
+// Counters is a set of counters that can be updated concurrently.
+// The zero value is ready to use.
+type Counters struct {
+	// These fields must be accessed atomically, and must be placed at the beginning of the struct
+	// in order to be 64-bit aligned on 32-bit platforms.
+	published       uint64
+	publishFailures uint64
+	delivered       uint64
+	dropped         uint64
+	decodeFailures  uint64
+	expired         uint64
+}
+
+// Published records the result of publishing a message.
+func (c *Counters) Published(err error) {
+	if err != nil {
+		atomic.AddUint64(&c.publishFailures, 1)
+	} else {
+		atomic.AddUint64(&c.published, 1)
+	}
+}
+
+// Delivered records that a message is sent to types.Pipe.Delivered.
+func (c *Counters) Delivered() {
+	atomic.AddUint64(&c.delivered, 1)
+}
+
+// Dropped records that a message is discarded.
+func (c *Counters) Dropped() {
+	atomic.AddUint64(&c.dropped, 1)
+}
+
+// DecodeFailed records that a message could not be decoded.
+func (c *Counters) DecodeFailed() {
+	atomic.AddUint64(&c.decodeFailures, 1)
+}
+
+// Expired records that a message is discarded because it has expired.
+func (c *Counters) Expired() {
+	atomic.AddUint64(&c.expired, 1)
+}
+
+// Snapshot returns the current values of the counters.
+func (c *Counters) Snapshot() types.AdapterStats {
+	return types.AdapterStats{
+		Published:       atomic.LoadUint64(&c.published),
+		PublishFailures: atomic.LoadUint64(&c.publishFailures),
+		Delivered:       atomic.LoadUint64(&c.delivered),
+		Dropped:         atomic.LoadUint64(&c.dropped),
+		DecodeFailures:  atomic.LoadUint64(&c.decodeFailures),
+		Expired:         atomic.LoadUint64(&c.expired),
+	}
+}
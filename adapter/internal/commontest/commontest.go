@@ -1,8 +1,10 @@
 package commontest
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"strconv"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -77,6 +79,86 @@ func AssertAdapterIsImplementedCorrectly(env AdapterEnv) {
 			})
 		})
 
+		Context("when the publisher waits for the result", func() {
+			It("reports the result of publishing", func() {
+				publish, delivered, _, pipe := newPipe()
+				adapter := env.NewAdapter()
+				adapter.Start(pipe)
+				defer adapter.Stop()
+				topic := "kfpemployees"
+				err := adapter.Subscribe(topic)
+				Expect(err).NotTo(HaveOccurred())
+				payload := []byte("kikkeriki~~~")
+				result := make(chan error, 1)
+				publish <- &types.Message{Topic: topic, Payload: payload, Result: result}
+				select {
+				case <-time.After(timeoutExpectedNotToExceed):
+					Fail("no result reported")
+				case err := <-result:
+					Expect(err).NotTo(HaveOccurred())
+				}
+				select {
+				case <-time.After(timeoutExpectedNotToExceed):
+					Fail("message disappeared")
+				case msg := <-delivered:
+					Expect(msg).To(Equal(&types.Message{Topic: topic, Payload: payload}))
+				}
+			})
+		})
+
+		Context("when the message has headers", func() {
+			It("sends headers together with the payload", func() {
+				publish, delivered, errors, pipe := newPipe()
+				adapter := env.NewAdapter()
+				adapter.Start(pipe)
+				defer adapter.Stop()
+				topic := "kfpemployees"
+				err := adapter.Subscribe(topic)
+				Expect(err).NotTo(HaveOccurred())
+				headers := map[string]string{"Correlation-Id": "kfp-001", "Content-Type": "text/plain"}
+				payload := []byte("kikkeriki~~~")
+				publish <- &types.Message{Topic: topic, Headers: headers, Payload: payload}
+				select {
+				case <-time.After(timeoutExpectedNotToExceed):
+					select {
+					case err := <-errors:
+						Expect(err).NotTo(HaveOccurred())
+					default:
+						Fail("message disappeared")
+					}
+				case msg := <-delivered:
+					Expect(msg).To(Equal(&types.Message{Topic: topic, Headers: headers, Payload: payload}))
+				}
+			})
+		})
+
+		Context("when the message has expired", func() {
+			It("discards the message", func() {
+				publish, delivered, _, pipe := newPipe()
+				adapter := env.NewAdapter()
+				adapter.Start(pipe)
+				defer adapter.Stop()
+				topic := "kfpemployees"
+				err := adapter.Subscribe(topic)
+				Expect(err).NotTo(HaveOccurred())
+				expiresAt := strconv.FormatInt(time.Now().Add(-time.Second).UnixNano(), 10)
+				headers := map[string]string{types.HeaderExpiresAt: expiresAt}
+				result := make(chan error, 1)
+				publish <- &types.Message{Topic: topic, Headers: headers, Payload: []byte("kikkeriki~~~"), Result: result}
+				select {
+				case <-time.After(timeoutExpectedNotToExceed):
+					Fail("no result reported")
+				case err := <-result:
+					Expect(err).To(MatchError(types.ErrExpired))
+				}
+				select {
+				case <-time.After(timeoutExpectedToExceed):
+				case <-delivered:
+					Fail("unexpected message arrived")
+				}
+			})
+		})
+
 		Context("when the adapter is not subscribing to the topic", func() {
 			It("does not send a message", func() {
 				publish, delivered, _, pipe := newPipe()
@@ -168,3 +250,404 @@ func AssertAdapterIsImplementedCorrectly(env AdapterEnv) {
 		})
 	})
 }
+
+// AssertPatternAdapterIsImplementedCorrectly asserts that adapters created by `env` implement types.PatternAdapter correctly.
+// `pattern` must match `matched` but not `unmatched` in the adapter's pattern syntax.
+func AssertPatternAdapterIsImplementedCorrectly(env AdapterEnv, pattern, matched, unmatched string) {
+	BeforeEach(func() {
+		env.Setup()
+	})
+
+	AfterEach(func() {
+		env.Teardown()
+	})
+
+	newPipe := func() (chan *types.Message, chan *types.Message, chan error, *types.Pipe) {
+		publish := make(chan *types.Message, 10)
+		delivered := make(chan *types.Message, 10)
+		errors := make(chan error, 10)
+		pipe := &types.Pipe{
+			Publish:   publish,
+			Delivered: delivered,
+			Errors:    errors,
+		}
+		return publish, delivered, errors, pipe
+	}
+
+	newPatternAdapter := func() types.PatternAdapter {
+		adapter, ok := env.NewAdapter().(types.PatternAdapter)
+		if !ok {
+			Fail("adapter does not implement types.PatternAdapter")
+		}
+		return adapter
+	}
+
+	Describe("SubscribePattern", func() {
+		Context("when the topic matches the pattern", func() {
+			It("sends a message together with the pattern", func() {
+				publish, delivered, errors, pipe := newPipe()
+				adapter := newPatternAdapter()
+				adapter.Start(pipe)
+				defer adapter.Stop()
+				err := adapter.SubscribePattern(pattern)
+				Expect(err).NotTo(HaveOccurred())
+				payload := []byte("kikkeriki~~~")
+				publish <- &types.Message{Topic: matched, Payload: payload}
+				select {
+				case <-time.After(timeoutExpectedNotToExceed):
+					select {
+					case err := <-errors:
+						Expect(err).NotTo(HaveOccurred())
+					default:
+						Fail("message disappeared")
+					}
+				case msg := <-delivered:
+					Expect(msg).To(Equal(&types.Message{Topic: matched, Payload: payload, Pattern: pattern}))
+				}
+			})
+		})
+
+		Context("when the topic does not match the pattern", func() {
+			It("does not send a message", func() {
+				publish, delivered, _, pipe := newPipe()
+				adapter := newPatternAdapter()
+				adapter.Start(pipe)
+				defer adapter.Stop()
+				err := adapter.SubscribePattern(pattern)
+				Expect(err).NotTo(HaveOccurred())
+				payload := []byte("kikkeriki~~~")
+				publish <- &types.Message{Topic: unmatched, Payload: payload}
+				select {
+				case <-time.After(timeoutExpectedToExceed):
+				case <-delivered:
+					Fail("unexpected message arrived")
+				}
+			})
+		})
+
+		Context("when the topic is subscribed both exactly and by the pattern", func() {
+			It("sends a message once for each of them", func() {
+				publish, delivered, errors, pipe := newPipe()
+				adapter := newPatternAdapter()
+				adapter.Start(pipe)
+				defer adapter.Stop()
+				err := adapter.Subscribe(matched)
+				Expect(err).NotTo(HaveOccurred())
+				err = adapter.SubscribePattern(pattern)
+				Expect(err).NotTo(HaveOccurred())
+				payload := []byte("kikkeriki~~~")
+				publish <- &types.Message{Topic: matched, Payload: payload}
+				patterns := []string{}
+				for i := 0; i < 2; i++ {
+					select {
+					case <-time.After(timeoutExpectedNotToExceed):
+						select {
+						case err := <-errors:
+							Expect(err).NotTo(HaveOccurred())
+						default:
+							Fail("message disappeared")
+						}
+					case msg := <-delivered:
+						Expect(msg.Topic).To(Equal(matched))
+						patterns = append(patterns, msg.Pattern)
+					}
+				}
+				Expect(patterns).To(ConsistOf("", pattern))
+			})
+		})
+
+		Context("when the pattern is unsubscribed", func() {
+			It("stops sending messages", func() {
+				publish, delivered, _, pipe := newPipe()
+				adapter := newPatternAdapter()
+				adapter.Start(pipe)
+				defer adapter.Stop()
+				err := adapter.SubscribePattern(pattern)
+				Expect(err).NotTo(HaveOccurred())
+				err = adapter.UnsubscribePattern(pattern)
+				Expect(err).NotTo(HaveOccurred())
+				payload := []byte("kikkeriki~~~")
+				publish <- &types.Message{Topic: matched, Payload: payload}
+				select {
+				case <-time.After(timeoutExpectedToExceed):
+				case <-delivered:
+					Fail("unexpected message arrived")
+				}
+			})
+		})
+	})
+}
+
+// AssertDrainAdapterIsImplementedCorrectly asserts that adapters created by `env` implement types.DrainAdapter correctly.
+func AssertDrainAdapterIsImplementedCorrectly(env AdapterEnv) {
+	BeforeEach(func() {
+		env.Setup()
+	})
+
+	AfterEach(func() {
+		env.Teardown()
+	})
+
+	Describe("Drain", func() {
+		It("publishes all messages remaining in the publish queue", func() {
+			publish := make(chan *types.Message, 10)
+			pipe := &types.Pipe{
+				Publish:   publish,
+				Delivered: make(chan *types.Message, 10),
+				Errors:    make(chan error, 10),
+			}
+			adapter, ok := env.NewAdapter().(types.DrainAdapter)
+			if !ok {
+				Fail("adapter does not implement types.DrainAdapter")
+			}
+			adapter.Start(pipe)
+			defer adapter.Stop()
+
+			n := cap(publish)
+			results := make([]chan error, 0, n)
+			for i := 0; i < n; i++ {
+				result := make(chan error, 1)
+				results = append(results, result)
+				publish <- &types.Message{Topic: "kfpemployees", Payload: []byte("kikkeriki~~~"), Result: result}
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			err := adapter.Drain(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			for i, result := range results {
+				select {
+				case err := <-result:
+					Expect(err).NotTo(HaveOccurred())
+				default:
+					Fail(fmt.Sprintf("%d: message not published", i))
+				}
+			}
+		})
+	})
+}
+
+func AssertStatsAdapterIsImplementedCorrectly(env AdapterEnv) {
+	BeforeEach(func() {
+		env.Setup()
+	})
+
+	AfterEach(func() {
+		env.Teardown()
+	})
+
+	Describe("Stats", func() {
+		It("counts messages published and delivered", func() {
+			publish := make(chan *types.Message, 10)
+			delivered := make(chan *types.Message, 10)
+			pipe := &types.Pipe{
+				Publish:   publish,
+				Delivered: delivered,
+				Errors:    make(chan error, 10),
+			}
+			adapter, ok := env.NewAdapter().(types.StatsAdapter)
+			if !ok {
+				Fail("adapter does not implement types.StatsAdapter")
+			}
+			adapter.Start(pipe)
+			defer adapter.Stop()
+			Expect(adapter.Stats()).To(Equal(types.AdapterStats{}))
+
+			topic := "kfpemployees"
+			err := adapter.Subscribe(topic)
+			Expect(err).NotTo(HaveOccurred())
+			result := make(chan error, 1)
+			publish <- &types.Message{Topic: topic, Payload: []byte("kikkeriki~~~"), Result: result}
+			select {
+			case <-time.After(timeoutExpectedNotToExceed):
+				Fail("no result reported")
+			case err := <-result:
+				Expect(err).NotTo(HaveOccurred())
+			}
+			select {
+			case <-time.After(timeoutExpectedNotToExceed):
+				Fail("message disappeared")
+			case <-delivered:
+			}
+			// Messages are counted as delivered right after they are sent to Pipe.Delivered.
+			Eventually(func() uint64 { return adapter.Stats().Delivered }, timeoutExpectedNotToExceed).Should(Equal(uint64(1)))
+			stats := adapter.Stats()
+			Expect(stats.Published).To(Equal(uint64(1)))
+			Expect(stats.PublishFailures).To(BeZero())
+			Expect(stats.Dropped).To(BeZero())
+			Expect(stats.DecodeFailures).To(BeZero())
+			Expect(stats.Expired).To(BeZero())
+		})
+
+		It("counts messages expired", func() {
+			publish := make(chan *types.Message, 10)
+			pipe := &types.Pipe{
+				Publish:   publish,
+				Delivered: make(chan *types.Message, 10),
+				Errors:    make(chan error, 10),
+			}
+			adapter, ok := env.NewAdapter().(types.StatsAdapter)
+			if !ok {
+				Fail("adapter does not implement types.StatsAdapter")
+			}
+			adapter.Start(pipe)
+			defer adapter.Stop()
+
+			expiresAt := strconv.FormatInt(time.Now().Add(-time.Second).UnixNano(), 10)
+			headers := map[string]string{types.HeaderExpiresAt: expiresAt}
+			result := make(chan error, 1)
+			publish <- &types.Message{Topic: "kfpemployees", Headers: headers, Payload: []byte("kikkeriki~~~"), Result: result}
+			select {
+			case <-time.After(timeoutExpectedNotToExceed):
+				Fail("no result reported")
+			case <-result:
+			}
+			stats := adapter.Stats()
+			Expect(stats.Expired).To(Equal(uint64(1)))
+			Expect(stats.Published).To(BeZero())
+		})
+	})
+}
+
+func AssertBatchAdapterIsImplementedCorrectly(env AdapterEnv) {
+	BeforeEach(func() {
+		env.Setup()
+	})
+
+	AfterEach(func() {
+		env.Teardown()
+	})
+
+	newPipe := func() (chan []*types.Message, chan *types.Message, *types.Pipe) {
+		publishBatch := make(chan []*types.Message, 10)
+		delivered := make(chan *types.Message, 10)
+		pipe := &types.Pipe{
+			Publish:      make(chan *types.Message, 10),
+			PublishBatch: publishBatch,
+			Delivered:    delivered,
+			Errors:       make(chan error, 10),
+		}
+		return publishBatch, delivered, pipe
+	}
+
+	newBatchAdapter := func() types.BatchAdapter {
+		adapter, ok := env.NewAdapter().(types.BatchAdapter)
+		if !ok {
+			Fail("adapter does not implement types.BatchAdapter")
+		}
+		return adapter
+	}
+
+	Describe("PublishBatch", func() {
+		It("sends all messages in the batch", func() {
+			publishBatch, delivered, pipe := newPipe()
+			adapter := newBatchAdapter()
+			adapter.Start(pipe)
+			defer adapter.Stop()
+			topic := "kfpemployees"
+			err := adapter.Subscribe(topic)
+			Expect(err).NotTo(HaveOccurred())
+
+			n := 3
+			batch := make([]*types.Message, 0, n)
+			results := make([]chan error, 0, n)
+			for i := 0; i < n; i++ {
+				result := make(chan error, 1)
+				results = append(results, result)
+				batch = append(batch, &types.Message{Topic: topic, Payload: []byte(strconv.Itoa(i)), Result: result})
+			}
+			publishBatch <- batch
+			for i, result := range results {
+				select {
+				case <-time.After(timeoutExpectedNotToExceed):
+					Fail(fmt.Sprintf("%d: no result reported", i))
+				case err := <-result:
+					Expect(err).NotTo(HaveOccurred())
+				}
+			}
+			for i := 0; i < n; i++ {
+				select {
+				case <-time.After(timeoutExpectedNotToExceed):
+					Fail("message disappeared")
+				case msg := <-delivered:
+					Expect(msg).To(Equal(&types.Message{Topic: topic, Payload: []byte(strconv.Itoa(i))}))
+				}
+			}
+		})
+
+		Context("when the batch contains expired messages", func() {
+			It("discards only the expired messages", func() {
+				publishBatch, delivered, pipe := newPipe()
+				adapter := newBatchAdapter()
+				adapter.Start(pipe)
+				defer adapter.Stop()
+				topic := "kfpemployees"
+				err := adapter.Subscribe(topic)
+				Expect(err).NotTo(HaveOccurred())
+
+				expiresAt := strconv.FormatInt(time.Now().Add(-time.Second).UnixNano(), 10)
+				expiredResult := make(chan error, 1)
+				result := make(chan error, 1)
+				publishBatch <- []*types.Message{
+					{Topic: topic, Headers: map[string]string{types.HeaderExpiresAt: expiresAt}, Payload: []byte("0"), Result: expiredResult},
+					{Topic: topic, Payload: []byte("1"), Result: result},
+				}
+				select {
+				case <-time.After(timeoutExpectedNotToExceed):
+					Fail("no result reported")
+				case err := <-expiredResult:
+					Expect(err).To(MatchError(types.ErrExpired))
+				}
+				select {
+				case <-time.After(timeoutExpectedNotToExceed):
+					Fail("no result reported")
+				case err := <-result:
+					Expect(err).NotTo(HaveOccurred())
+				}
+				select {
+				case <-time.After(timeoutExpectedNotToExceed):
+					Fail("message disappeared")
+				case msg := <-delivered:
+					Expect(msg).To(Equal(&types.Message{Topic: topic, Payload: []byte("1")}))
+				}
+				select {
+				case <-time.After(timeoutExpectedToExceed):
+				case msg := <-delivered:
+					Fail(fmt.Sprintf("unexpected message arrived: %v", msg))
+				}
+			})
+		})
+
+		Context("when the adapter is drained", func() {
+			It("publishes all batches remaining in the queue", func() {
+				publishBatch, _, pipe := newPipe()
+				adapter := newBatchAdapter()
+				drainAdapter, ok := adapter.(types.DrainAdapter)
+				if !ok {
+					Skip("adapter does not implement types.DrainAdapter")
+				}
+				adapter.Start(pipe)
+				defer adapter.Stop()
+
+				n := cap(publishBatch)
+				results := make([]chan error, 0, n)
+				for i := 0; i < n; i++ {
+					result := make(chan error, 1)
+					results = append(results, result)
+					publishBatch <- []*types.Message{{Topic: "kfpemployees", Payload: []byte("kikkeriki~~~"), Result: result}}
+				}
+				ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+				defer cancel()
+				err := drainAdapter.Drain(ctx)
+				Expect(err).NotTo(HaveOccurred())
+				for i, result := range results {
+					select {
+					case err := <-result:
+						Expect(err).NotTo(HaveOccurred())
+					default:
+						Fail(fmt.Sprintf("%d: message not published", i))
+					}
+				}
+			})
+		})
+	})
+}
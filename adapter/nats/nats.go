@@ -2,12 +2,14 @@
 package nats
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"time"
 
 	"github.com/nats-io/nats.go"
 
+	"github.com/genkami/kiara/adapter/internal/adapterstats"
 	"github.com/genkami/kiara/types"
 )
 
@@ -17,6 +19,9 @@ import (
 // You can configure the length of this "another channels" with DeliveredChannelSize().
 const receivedNatsMsgChSize = 10
 
+// This is the interval of checking whether the connection finishes draining.
+var drainPollInterval = 10 * time.Millisecond
+
 var (
 	// This error is reported via Adapter.Errors() when the adapter can't deliver
 	// succeeding messages arrived from NATS because Adapter.Delivered() is already full.
@@ -28,19 +33,29 @@ var (
 
 // Adapter is an adapter that sends messages through NATS.
 type Adapter struct {
-	conn              *nats.Conn
-	receivedNatsMsgCh chan *nats.Msg
-	pipe              *types.Pipe
+	conn                     *nats.Conn
+	receivedNatsMsgCh        chan *nats.Msg
+	receivedNatsPatternMsgCh chan *nats.Msg
+	pipe                     *types.Pipe
+	tasks                    chan func()
 
 	done   chan struct{}
 	doneWg sync.WaitGroup
+	stats  *adapterstats.Counters
 	opts   options
 
-	subsLock sync.Mutex
-	subs     map[string]*nats.Subscription
+	subsLock    sync.Mutex
+	subs        map[string]*nats.Subscription
+	patternSubs map[string]*nats.Subscription
 }
 
-var _ types.Adapter = &Adapter{}
+var (
+	_ types.PatternAdapter = &Adapter{}
+	_ types.RequestAdapter = &Adapter{}
+	_ types.DrainAdapter   = &Adapter{}
+	_ types.StatsAdapter   = &Adapter{}
+	_ types.BatchAdapter   = &Adapter{}
+)
 
 // NewAdapter creates a new Adapter.
 func NewAdapter(conn *nats.Conn, options ...Option) *Adapter {
@@ -49,11 +64,15 @@ func NewAdapter(conn *nats.Conn, options ...Option) *Adapter {
 		o.apply(&opts)
 	}
 	a := &Adapter{
-		conn:              conn,
-		receivedNatsMsgCh: make(chan *nats.Msg, receivedNatsMsgChSize),
-		done:              make(chan struct{}),
-		opts:              opts,
-		subs:              map[string]*nats.Subscription{},
+		conn:                     conn,
+		receivedNatsMsgCh:        make(chan *nats.Msg, receivedNatsMsgChSize),
+		receivedNatsPatternMsgCh: make(chan *nats.Msg, receivedNatsMsgChSize),
+		tasks:                    make(chan func()),
+		done:                     make(chan struct{}),
+		stats:                    &adapterstats.Counters{},
+		opts:                     opts,
+		subs:                     map[string]*nats.Subscription{},
+		patternSubs:              map[string]*nats.Subscription{},
 	}
 	return a
 }
@@ -76,26 +95,19 @@ func (a *Adapter) run() {
 		case <-a.done:
 			return
 		case msg := <-a.pipe.Publish:
-			err := a.conn.Publish(msg.Topic, msg.Payload)
-			if err != nil {
-				select {
-				case a.pipe.Errors <- err:
-				default:
-					// discard
-				}
-			}
+			a.publish(msg)
+		case msgs := <-a.pipe.PublishBatch:
+			a.publishBatch(msgs)
 		case natsMsg := <-a.receivedNatsMsgCh:
-			msg := &types.Message{Topic: natsMsg.Subject, Payload: natsMsg.Data}
-			select {
-			case a.pipe.Delivered <- msg:
-			default:
-				select {
-				case a.pipe.Errors <- ErrSlowConsumer:
-				default:
-					// discard
-				}
-			}
+			a.deliver(fromNatsMsg(natsMsg))
+		case natsMsg := <-a.receivedNatsPatternMsgCh:
+			a.deliver(fromNatsPatternMsg(natsMsg))
+		case task := <-a.tasks:
+			task()
 		case <-ticker.C:
+			if a.conn.IsDraining() || a.conn.IsClosed() {
+				continue
+			}
 			err := a.conn.Flush()
 			if err != nil {
 				select {
@@ -108,6 +120,152 @@ func (a *Adapter) run() {
 	}
 }
 
+func (a *Adapter) publish(msg *types.Message) {
+	if a.discardExpired(msg) {
+		return
+	}
+	err := a.conn.PublishMsg(toNatsMsg(msg))
+	if err == nil && msg.Result != nil {
+		// Messages are buffered until flushed, so we have to flush it in order to confirm that the server received the message.
+		err = a.conn.Flush()
+	}
+	a.completePublish(msg, err)
+}
+
+// publishBatch buffers all messages and then flushes them at once.
+func (a *Adapter) publishBatch(msgs []*types.Message) {
+	discarded := make([]bool, len(msgs))
+	errs := make([]error, len(msgs))
+	buffered := false
+	for i, msg := range msgs {
+		if a.discardExpired(msg) {
+			discarded[i] = true
+			continue
+		}
+		errs[i] = a.conn.PublishMsg(toNatsMsg(msg))
+		buffered = buffered || errs[i] == nil
+	}
+	if buffered {
+		err := a.conn.Flush()
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = err
+			}
+		}
+	}
+	for i, msg := range msgs {
+		if !discarded[i] {
+			a.completePublish(msg, errs[i])
+		}
+	}
+}
+
+// discardExpired discards `msg` and returns true if it has expired.
+func (a *Adapter) discardExpired(msg *types.Message) bool {
+	if !msg.Expired(time.Now()) {
+		return false
+	}
+	a.stats.Expired()
+	msg.Complete(types.ErrExpired)
+	return true
+}
+
+// completePublish records the result of publishing `msg` and reports it.
+func (a *Adapter) completePublish(msg *types.Message, err error) {
+	a.stats.Published(err)
+	if !msg.Complete(err) && err != nil {
+		select {
+		case a.pipe.Errors <- &types.PublishError{Topic: msg.Topic, Err: err}:
+		default:
+			// discard
+		}
+	}
+}
+
+// Drain publishes all messages remaining in types.Pipe.Publish and types.Pipe.PublishBatch, and drains the connection with nats.Conn.Drain,
+// so that all subscriptions stop receiving new messages and messages that have already arrived are delivered.
+// The connection is closed once it finishes draining.
+func (a *Adapter) Drain(ctx context.Context) error {
+	err := a.runTask(ctx, a.publishRemaining)
+	if err != nil {
+		return err
+	}
+	err = a.conn.Drain()
+	if err != nil {
+		return err
+	}
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for !a.conn.IsClosed() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return a.runTask(ctx, a.deliverRemaining)
+}
+
+// runTask runs `task` in the goroutine that runs `run` and waits until it finishes.
+func (a *Adapter) runTask(ctx context.Context, task func()) error {
+	done := make(chan struct{})
+	select {
+	case a.tasks <- func() { task(); close(done) }:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (a *Adapter) publishRemaining() {
+	for {
+		select {
+		case msg := <-a.pipe.Publish:
+			a.publish(msg)
+		case msgs := <-a.pipe.PublishBatch:
+			a.publishBatch(msgs)
+		default:
+			return
+		}
+	}
+}
+
+func (a *Adapter) deliverRemaining() {
+	for {
+		select {
+		case natsMsg := <-a.receivedNatsMsgCh:
+			a.deliver(fromNatsMsg(natsMsg))
+		case natsMsg := <-a.receivedNatsPatternMsgCh:
+			a.deliver(fromNatsPatternMsg(natsMsg))
+		default:
+			return
+		}
+	}
+}
+
+func (a *Adapter) deliver(msg *types.Message) {
+	if msg.Expired(time.Now()) {
+		a.stats.Expired()
+		return
+	}
+	select {
+	case a.pipe.Delivered <- msg:
+		a.stats.Delivered()
+	default:
+		a.stats.Dropped()
+		select {
+		case a.pipe.Errors <- &types.DeliveryError{Topic: msg.Topic, Payload: msg.Payload, Err: ErrSlowConsumer}:
+		default:
+			// discard
+		}
+	}
+}
+
 func (a *Adapter) Subscribe(topic string) error {
 	a.subsLock.Lock()
 	defer a.subsLock.Unlock()
@@ -144,14 +302,119 @@ func (a *Adapter) Unsubscribe(topic string) error {
 	return nil
 }
 
+// SubscribePattern subscribes subjects that match the given pattern, which may contain wildcards `*` and `>`.
+// See https://docs.nats.io/nats-concepts/subjects#wildcards for the syntax of patterns.
+func (a *Adapter) SubscribePattern(pattern string) error {
+	a.subsLock.Lock()
+	defer a.subsLock.Unlock()
+	if _, ok := a.patternSubs[pattern]; ok {
+		return ErrAlreadySubscribed
+	}
+
+	sub, err := a.conn.ChanSubscribe(pattern, a.receivedNatsPatternMsgCh)
+	if err != nil {
+		return err
+	}
+	a.patternSubs[pattern] = sub
+	err = a.conn.Flush()
+	if err != nil {
+		select {
+		case a.pipe.Errors <- err:
+		default:
+			// discard
+		}
+	}
+	return nil
+}
+
+func (a *Adapter) UnsubscribePattern(pattern string) error {
+	a.subsLock.Lock()
+	defer a.subsLock.Unlock()
+	if sub, ok := a.patternSubs[pattern]; ok {
+		err := sub.Unsubscribe()
+		if err != nil {
+			return err
+		}
+		delete(a.patternSubs, pattern)
+	}
+	return nil
+}
+
+// Request sends a message and waits for a reply using the NATS's native inbox mechanism.
+func (a *Adapter) Request(ctx context.Context, msg *types.Message) (*types.Message, error) {
+	reply, err := a.conn.RequestMsgWithContext(ctx, toNatsMsg(msg))
+	if err != nil {
+		return nil, err
+	}
+	return fromNatsMsg(reply), nil
+}
+
+// MaxBatchSize returns 0 because batches of any size are buffered by the NATS client and flushed at once.
+func (a *Adapter) MaxBatchSize() int {
+	return 0
+}
+
+// Stats returns statistics of messages that this adapter handled.
+// Messages that the NATS client discarded as a slow consumer are counted as dropped, but their number is not accurate
+// because the client reports only the first one of consecutive drops.
+func (a *Adapter) Stats() types.AdapterStats {
+	return a.stats.Snapshot()
+}
+
 func (a *Adapter) Stop() {
 	close(a.done)
 	a.doneWg.Wait()
 	a.conn.Close()
 }
 
+// toNatsMsg converts a message into nats.Msg.
+// Headers are only set when the message has them because servers older than 2.2 do not support headers.
+func toNatsMsg(msg *types.Message) *nats.Msg {
+	natsMsg := &nats.Msg{Subject: msg.Topic, Data: msg.Payload}
+	if len(msg.Headers) > 0 {
+		natsMsg.Header = nats.Header{}
+		for k, v := range msg.Headers {
+			natsMsg.Header.Set(k, v)
+		}
+	}
+	return natsMsg
+}
+
+// fromNatsMsg converts nats.Msg into a message.
+// When a header has more than one value, only the first one is used.
+// The reply subject of nats.Msg is exposed as types.HeaderReplyTo.
+func fromNatsMsg(natsMsg *nats.Msg) *types.Message {
+	msg := &types.Message{Topic: natsMsg.Subject, Payload: natsMsg.Data}
+	if len(natsMsg.Header) > 0 || natsMsg.Reply != "" {
+		msg.Headers = make(map[string]string, len(natsMsg.Header)+1)
+		for k, v := range natsMsg.Header {
+			if len(v) > 0 {
+				msg.Headers[k] = v[0]
+			}
+		}
+		if natsMsg.Reply != "" {
+			msg.Headers[types.HeaderReplyTo] = natsMsg.Reply
+		}
+	}
+	return msg
+}
+
+// fromNatsPatternMsg converts nats.Msg that arrived through a pattern subscription into a message.
+func fromNatsPatternMsg(natsMsg *nats.Msg) *types.Message {
+	msg := fromNatsMsg(natsMsg)
+	msg.Pattern = natsMsg.Sub.Subject
+	return msg
+}
+
 func (a *Adapter) natsErrorHandler() nats.ErrHandler {
-	return func(_ *nats.Conn, _ *nats.Subscription, err error) {
+	return func(_ *nats.Conn, sub *nats.Subscription, err error) {
+		if sub != nil {
+			// e.g. nats.ErrSlowConsumer
+			if errors.Is(err, nats.ErrSlowConsumer) {
+				a.stats.Dropped()
+			}
+			err = &types.DeliveryError{Topic: sub.Subject, Err: err}
+		}
 		select {
 		case a.pipe.Errors <- err:
 		default:
@@ -162,6 +425,10 @@ func (a *Adapter) natsErrorHandler() nats.ErrHandler {
 
 func (a *Adapter) natsConnErrorHandler() nats.ConnErrHandler {
 	return func(_ *nats.Conn, err error) {
+		if err == nil {
+			// disconnected gracefully
+			return
+		}
 		select {
 		case a.pipe.Errors <- err:
 		default:
@@ -1,6 +1,9 @@
 package nats_test
 
 import (
+	"context"
+	"time"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -33,4 +36,64 @@ func (e *env) NewAdapter() types.Adapter {
 
 var _ = Describe("Nats", func() {
 	commontest.AssertAdapterIsImplementedCorrectly(&env{})
+	commontest.AssertDrainAdapterIsImplementedCorrectly(&env{})
+	commontest.AssertStatsAdapterIsImplementedCorrectly(&env{})
+	commontest.AssertBatchAdapterIsImplementedCorrectly(&env{})
+	commontest.AssertPatternAdapterIsImplementedCorrectly(&env{}, "kfp.*", "kfp.employees", "holox.employees")
+})
+
+var _ = Describe("Nats Request", func() {
+	newPipe := func() (chan *types.Message, *types.Pipe) {
+		delivered := make(chan *types.Message, 10)
+		pipe := &types.Pipe{
+			Publish:   make(chan *types.Message, 10),
+			Delivered: delivered,
+			Errors:    make(chan error, 10),
+		}
+		return delivered, pipe
+	}
+
+	It("sends a request through the native inbox mechanism", func() {
+		conn, err := nats.Connect(natsUrl)
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+		topic := "kfp.rpc"
+		natsSub, err := conn.Subscribe(topic, func(msg *nats.Msg) {
+			Expect(msg.Respond([]byte("kikkeriki~~~"))).NotTo(HaveOccurred())
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer natsSub.Unsubscribe()
+		Expect(conn.Flush()).NotTo(HaveOccurred())
+
+		_, pipe := newPipe()
+		a := (&env{}).NewAdapter().(types.RequestAdapter)
+		a.Start(pipe)
+		defer a.Stop()
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		reply, err := a.Request(ctx, &types.Message{Topic: topic, Payload: []byte("hello")})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reply.Payload).To(Equal([]byte("kikkeriki~~~")))
+	})
+
+	It("exposes the reply subject as a header", func() {
+		delivered, pipe := newPipe()
+		a := (&env{}).NewAdapter()
+		a.Start(pipe)
+		defer a.Stop()
+		topic := "kfp.rpc"
+		Expect(a.Subscribe(topic)).NotTo(HaveOccurred())
+
+		conn, err := nats.Connect(natsUrl)
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+		Expect(conn.PublishRequest(topic, "kfp.reply", []byte("hello"))).NotTo(HaveOccurred())
+		Expect(conn.Flush()).NotTo(HaveOccurred())
+		select {
+		case msg := <-delivered:
+			Expect(msg.Headers).To(HaveKeyWithValue(types.HeaderReplyTo, "kfp.reply"))
+		case <-time.After(3 * time.Second):
+			Fail("timeout")
+		}
+	})
 })
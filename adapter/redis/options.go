@@ -7,18 +7,21 @@ import (
 var (
 	defaultSubscriptionTimeout = 3 * time.Second
 	defaultPublishTimeout      = 3 * time.Second
+	defaultMaxBatchSize        = 1000
 )
 
 // option is a configuration of Adapter.
 type options struct {
 	subscriptionTimeout time.Duration
 	publishTimeout      time.Duration
+	maxBatchSize        int
 }
 
 func defaultOptions() options {
 	return options{
 		subscriptionTimeout: defaultSubscriptionTimeout,
 		publishTimeout:      defaultPublishTimeout,
+		maxBatchSize:        defaultMaxBatchSize,
 	}
 }
 
@@ -46,3 +49,11 @@ func PublishTimeout(timeout time.Duration) Option {
 		opts.publishTimeout = timeout
 	})
 }
+
+// MaxBatchSize sets the maximum number of messages that are sent by a single pipeline when publishing a batch.
+// Larger batches given to kiara.PubSub.PublishBatch are split into pipelines of this size. The default is 1000.
+func MaxBatchSize(size int) Option {
+	return optionFunc(func(opts *options) {
+		opts.maxBatchSize = size
+	})
+}
@@ -50,4 +50,21 @@ var _ = Describe("Options", func() {
 			})
 		})
 	})
+
+	Describe("MaxBatchSize", func() {
+		Context("when the option is not set", func() {
+			It("uses the default value", func() {
+				adapter := newAdapter()
+				Expect(adapter.MaxBatchSize()).To(Equal(defaultMaxBatchSize))
+			})
+		})
+
+		Context("when the option is set", func() {
+			It("uses the give value", func() {
+				size := 445
+				adapter := newAdapter(MaxBatchSize(size))
+				Expect(adapter.MaxBatchSize()).To(Equal(size))
+			})
+		})
+	})
 })
@@ -5,9 +5,11 @@ import (
 	"context"
 	"errors"
 	"sync"
+	"time"
 
 	"github.com/go-redis/redis/v8"
 
+	"github.com/genkami/kiara/adapter/internal/adapterstats"
 	"github.com/genkami/kiara/types"
 )
 
@@ -24,17 +26,30 @@ type RedisClient interface {
 	Close() error
 }
 
+// pipelineClient is a RedisClient that supports pipelining, such as *redis.Client.
+// When the client does not implement this, messages in a batch are published one by one.
+type pipelineClient interface {
+	Pipeline() redis.Pipeliner
+}
+
 // Adapter is an adapter that sends message through Redis PubSub
 type Adapter struct {
 	client RedisClient
 	pubSub *redis.PubSub
 	pipe   *types.Pipe
+	tasks  chan func()
 	done   chan struct{}
 	doneWg sync.WaitGroup
+	stats  *adapterstats.Counters
 	opts   options
 }
 
-var _ types.Adapter = &Adapter{}
+var (
+	_ types.PatternAdapter = &Adapter{}
+	_ types.DrainAdapter   = &Adapter{}
+	_ types.StatsAdapter   = &Adapter{}
+	_ types.BatchAdapter   = &Adapter{}
+)
 
 // NewAdapter returns a new Adapter.
 func NewAdapter(client RedisClient, options ...Option) *Adapter {
@@ -46,7 +61,9 @@ func NewAdapter(client RedisClient, options ...Option) *Adapter {
 		client: client,
 		// NOTE: client.Subscribe() does not block when channels is not given.
 		pubSub: client.Subscribe(context.Background()),
+		tasks:  make(chan func()),
 		done:   make(chan struct{}),
+		stats:  &adapterstats.Counters{},
 		opts:   opts,
 	}
 	return a
@@ -66,33 +83,169 @@ func (a *Adapter) run() {
 		case <-a.done:
 			return
 		case msg := <-a.pipe.Publish:
-			func() {
-				ctx, cancel := context.WithTimeout(context.Background(), a.opts.publishTimeout)
-				defer cancel()
-				err := a.client.Publish(ctx, msg.Topic, string(msg.Payload)).Err()
-				if err != nil {
-					select {
-					case a.pipe.Errors <- err:
-					default:
-						// discard
-					}
-				}
-			}()
+			a.publish(msg)
+		case msgs := <-a.pipe.PublishBatch:
+			a.publishBatch(msgs)
+		case m := <-msgCh:
+			a.deliver(m)
+		case task := <-a.tasks:
+			task()
+		}
+	}
+}
+
+func (a *Adapter) publish(msg *types.Message) {
+	if a.discardExpired(msg) {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), a.opts.publishTimeout)
+	defer cancel()
+	err := a.client.Publish(ctx, msg.Topic, encodeMessage(msg)).Err()
+	a.completePublish(msg, err)
+}
+
+// publishBatch publishes messages by a single pipeline.
+func (a *Adapter) publishBatch(msgs []*types.Message) {
+	client, ok := a.client.(pipelineClient)
+	if !ok {
+		for _, msg := range msgs {
+			a.publish(msg)
+		}
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), a.opts.publishTimeout)
+	defer cancel()
+	pipe := client.Pipeline()
+	cmds := make([]*redis.IntCmd, len(msgs))
+	for i, msg := range msgs {
+		if a.discardExpired(msg) {
+			continue
+		}
+		cmds[i] = pipe.Publish(ctx, msg.Topic, encodeMessage(msg))
+	}
+	// Errors are reported for each command below.
+	_, _ = pipe.Exec(ctx)
+	for i, msg := range msgs {
+		if cmds[i] != nil {
+			a.completePublish(msg, cmds[i].Err())
+		}
+	}
+}
+
+// discardExpired discards `msg` and returns true if it has expired.
+func (a *Adapter) discardExpired(msg *types.Message) bool {
+	if !msg.Expired(time.Now()) {
+		return false
+	}
+	a.stats.Expired()
+	msg.Complete(types.ErrExpired)
+	return true
+}
+
+// completePublish records the result of publishing `msg` and reports it.
+func (a *Adapter) completePublish(msg *types.Message, err error) {
+	a.stats.Published(err)
+	if !msg.Complete(err) && err != nil {
+		select {
+		case a.pipe.Errors <- &types.PublishError{Topic: msg.Topic, Err: err}:
+		default:
+			// discard
+		}
+	}
+}
+
+func (a *Adapter) deliver(m *redis.Message) {
+	msg, err := decodeMessage(m.Channel, m.Payload)
+	if err != nil {
+		a.stats.DecodeFailed()
+		select {
+		case a.pipe.Errors <- &types.DeliveryError{Topic: m.Channel, Payload: []byte(m.Payload), Err: err}:
+		default:
+			// discard
+		}
+		return
+	}
+	msg.Pattern = m.Pattern
+	if msg.Expired(time.Now()) {
+		a.stats.Expired()
+		return
+	}
+	select {
+	case a.pipe.Delivered <- msg:
+		a.stats.Delivered()
+	default:
+		a.stats.Dropped()
+		select {
+		case a.pipe.Errors <- &types.DeliveryError{Topic: msg.Topic, Payload: msg.Payload, Err: ErrSlowConsumer}:
+		default:
+			// discard
+		}
+	}
+}
+
+// Drain publishes all messages remaining in types.Pipe.Publish and types.Pipe.PublishBatch, unsubscribes all topics and patterns,
+// and sends messages that have already arrived to types.Pipe.Delivered.
+//
+// Note that Redis does not tell when messages published just before unsubscribing arrive,
+// so such messages may be lost.
+func (a *Adapter) Drain(ctx context.Context) error {
+	err := a.runTask(ctx, a.publishRemaining)
+	if err != nil {
+		return err
+	}
+	err = a.pubSub.Unsubscribe(ctx)
+	if err != nil {
+		return err
+	}
+	err = a.pubSub.PUnsubscribe(ctx)
+	if err != nil {
+		return err
+	}
+	return a.runTask(ctx, a.deliverRemaining)
+}
+
+func (a *Adapter) publishRemaining() {
+	for {
+		select {
+		case msg := <-a.pipe.Publish:
+			a.publish(msg)
+		case msgs := <-a.pipe.PublishBatch:
+			a.publishBatch(msgs)
+		default:
+			return
+		}
+	}
+}
+
+func (a *Adapter) deliverRemaining() {
+	// NOTE: PubSub.Channel() always returns the same channel.
+	msgCh := a.pubSub.Channel()
+	for {
+		select {
 		case m := <-msgCh:
-			msg := &types.Message{Topic: m.Channel, Payload: []byte(m.Payload)}
-			select {
-			case a.pipe.Delivered <- msg:
-			default:
-				select {
-				case a.pipe.Errors <- ErrSlowConsumer:
-				default:
-					// discard
-				}
-			}
+			a.deliver(m)
+		default:
+			return
 		}
 	}
 }
 
+// runTask runs `task` in the goroutine that runs `run` and waits until it finishes.
+func (a *Adapter) runTask(ctx context.Context, task func()) error {
+	done := make(chan struct{})
+	select {
+	case a.tasks <- func() { task(); close(done) }:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 func (a *Adapter) Subscribe(topic string) error {
 	ctx, cancel := context.WithTimeout(context.Background(), a.opts.subscriptionTimeout)
 	defer cancel()
@@ -105,6 +258,31 @@ func (a *Adapter) Unsubscribe(topic string) error {
 	return a.pubSub.Unsubscribe(ctx, topic)
 }
 
+// SubscribePattern subscribes topics that match the given pattern by PSUBSCRIBE.
+// See https://redis.io/commands/psubscribe for the syntax of patterns.
+func (a *Adapter) SubscribePattern(pattern string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), a.opts.subscriptionTimeout)
+	defer cancel()
+	return a.pubSub.PSubscribe(ctx, pattern)
+}
+
+func (a *Adapter) UnsubscribePattern(pattern string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), a.opts.subscriptionTimeout)
+	defer cancel()
+	return a.pubSub.PUnsubscribe(ctx, pattern)
+}
+
+// MaxBatchSize returns the maximum number of messages that are sent by a single pipeline.
+// It can be configured by MaxBatchSize option.
+func (a *Adapter) MaxBatchSize() int {
+	return a.opts.maxBatchSize
+}
+
+// Stats returns statistics of messages that this adapter handled.
+func (a *Adapter) Stats() types.AdapterStats {
+	return a.stats.Snapshot()
+}
+
 func (a *Adapter) Stop() {
 	close(a.done)
 	a.doneWg.Wait()
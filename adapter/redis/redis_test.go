@@ -30,4 +30,8 @@ func (e *env) NewAdapter() types.Adapter {
 
 var _ = Describe("Redis", func() {
 	commontest.AssertAdapterIsImplementedCorrectly(&env{})
+	commontest.AssertDrainAdapterIsImplementedCorrectly(&env{})
+	commontest.AssertStatsAdapterIsImplementedCorrectly(&env{})
+	commontest.AssertBatchAdapterIsImplementedCorrectly(&env{})
+	commontest.AssertPatternAdapterIsImplementedCorrectly(&env{}, "kfp:*", "kfp:employees", "holox:employees")
 })
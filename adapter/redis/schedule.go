@@ -0,0 +1,106 @@
+package redis
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+
+	"github.com/genkami/kiara/types"
+)
+
+// ScheduleClient is an abstract interface for Redis client that ScheduleStore uses.
+// *redis.Client satisfies both this and RedisClient.
+type ScheduleClient interface {
+	ZAdd(ctx context.Context, key string, members ...*redis.Z) *redis.IntCmd
+	ZRangeByScore(ctx context.Context, key string, opt *redis.ZRangeBy) *redis.StringSliceCmd
+	ZRangeWithScores(ctx context.Context, key string, start, stop int64) *redis.ZSliceCmd
+	ZRem(ctx context.Context, key string, members ...interface{}) *redis.IntCmd
+}
+
+// ScheduleStore is a types.ScheduleStore that keeps messages in a Redis sorted set, scored by their scheduled time
+// in milliseconds since the Unix epoch. It can be shared by all PubSubs that use the same key;
+// each message is published by only one of them, and at most once (see types.ScheduleStore).
+//
+// Messages are identified by their topic, headers and payload, so identical messages are stored only once.
+// Give each message a unique ID by kiara.WithMessageIDs or kiara.WithMessageID if identical messages may be scheduled.
+type ScheduleStore struct {
+	client ScheduleClient
+	key    string
+}
+
+var _ types.ScheduleStore = &ScheduleStore{}
+
+// NewScheduleStore returns a new ScheduleStore that keeps messages in the sorted set of the given key.
+func NewScheduleStore(client ScheduleClient, key string) *ScheduleStore {
+	return &ScheduleStore{client: client, key: key}
+}
+
+func (s *ScheduleStore) Add(ctx context.Context, msg *types.Message, at time.Time) error {
+	member := &redis.Z{Score: float64(at.UnixMilli()), Member: encodeScheduled(msg)}
+	return s.client.ZAdd(ctx, s.key, member).Err()
+}
+
+// Due removes messages that are due from the sorted set and returns them.
+// A message is only returned when this store actually removes it, so that it is not published by more than one PubSub.
+// This also means that the message is lost if the PubSub fails to publish it after then.
+func (s *ScheduleStore) Due(ctx context.Context, now time.Time) ([]*types.Message, error) {
+	members, err := s.client.ZRangeByScore(ctx, s.key, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	var msgs []*types.Message
+	for _, member := range members {
+		removed, err := s.client.ZRem(ctx, s.key, member).Result()
+		if err != nil {
+			return msgs, err
+		}
+		if removed <= 0 {
+			// Another PubSub has taken the message.
+			continue
+		}
+		msg, err := decodeScheduled(member)
+		if err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, nil
+}
+
+func (s *ScheduleStore) Next(ctx context.Context) (time.Time, bool, error) {
+	members, err := s.client.ZRangeWithScores(ctx, s.key, 0, 0).Result()
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	if len(members) <= 0 {
+		return time.Time{}, false, nil
+	}
+	return time.UnixMilli(int64(members[0].Score)), true, nil
+}
+
+// encodeScheduled converts a message into a member of the sorted set.
+// Scheduled messages are framed like this, where the message is encoded by encodeMessage:
+//
+//	uvarint(len(topic)) | topic | message
+func encodeScheduled(msg *types.Message) string {
+	var buf bytes.Buffer
+	writeString(&buf, msg.Topic)
+	buf.WriteString(encodeMessage(msg))
+	return buf.String()
+}
+
+// decodeScheduled parses a member of the sorted set.
+func decodeScheduled(data string) (*types.Message, error) {
+	r := bytes.NewReader([]byte(data))
+	topic, err := readString(r)
+	if err != nil {
+		return nil, err
+	}
+	return decodeMessage(topic, data[len(data)-r.Len():])
+}
@@ -0,0 +1,98 @@
+package redis_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	adapter "github.com/genkami/kiara/adapter/redis"
+	"github.com/genkami/kiara/types"
+)
+
+var _ = Describe("ScheduleStore", func() {
+	var (
+		client *redis.Client
+		key    string
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		client = redis.NewClient(&redis.Options{Addr: redisAddr})
+		key = fmt.Sprintf("kiara:test:schedule:%d", time.Now().UnixNano())
+		ctx, cancel = context.WithTimeout(context.Background(), 3*time.Second)
+	})
+
+	AfterEach(func() {
+		client.Del(ctx, key)
+		cancel()
+		client.Close()
+	})
+
+	newMessage := func(id string) *types.Message {
+		return &types.Message{
+			Topic:   "kfpemployees",
+			Headers: map[string]string{types.HeaderMessageID: id},
+			Payload: []byte("kikkeriki~~~"),
+		}
+	}
+
+	Context("when the store is empty", func() {
+		It("has neither the next time nor messages due", func() {
+			store := adapter.NewScheduleStore(client, key)
+			_, ok, err := store.Next(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeFalse())
+			msgs, err := store.Due(ctx, time.Now())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(msgs).To(BeEmpty())
+		})
+	})
+
+	Context("when messages are added", func() {
+		It("returns messages in order of their scheduled time once they are due", func() {
+			store := adapter.NewScheduleStore(client, key)
+			now := time.UnixMilli(time.Now().UnixMilli())
+			Expect(store.Add(ctx, newMessage("kfp-002"), now.Add(2*time.Second))).To(Succeed())
+			Expect(store.Add(ctx, newMessage("kfp-001"), now.Add(time.Second))).To(Succeed())
+			Expect(store.Add(ctx, newMessage("kfp-003"), now.Add(3*time.Second))).To(Succeed())
+
+			next, ok, err := store.Next(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(next).To(BeTemporally("==", now.Add(time.Second)))
+
+			msgs, err := store.Due(ctx, now.Add(2*time.Second))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(msgs).To(Equal([]*types.Message{newMessage("kfp-001"), newMessage("kfp-002")}))
+
+			msgs, err = store.Due(ctx, now.Add(2*time.Second))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(msgs).To(BeEmpty())
+
+			next, ok, err = store.Next(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(next).To(BeTemporally("==", now.Add(3*time.Second)))
+		})
+	})
+
+	Context("when the store is shared", func() {
+		It("returns each message only once", func() {
+			store := adapter.NewScheduleStore(client, key)
+			another := adapter.NewScheduleStore(client, key)
+			now := time.Now()
+			Expect(store.Add(ctx, newMessage("kfp-001"), now)).To(Succeed())
+			msgs, err := store.Due(ctx, now)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(msgs).To(HaveLen(1))
+			msgs, err = another.Due(ctx, now)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(msgs).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,102 @@
+package redis
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"github.com/genkami/kiara/types"
+)
+
+// Redis PubSub can only send a single string, so messages that have headers are framed like this:
+//
+//	wireMagic | uvarint(number of headers) | (uvarint(len(key)) | key | uvarint(len(value)) | value)* | payload
+//
+// Messages without headers are sent as raw payloads so that they can be read by older versions of the adapter,
+// unless their payloads start with wireMagic, in which case they are framed with no headers so as not to be mistaken for framed ones.
+const wireMagic = "\x00KIARA\x01"
+
+var (
+	// This error is reported via types.Pipe.Errors when the adapter receives a broken message from Redis.
+	ErrMalformedMessage = errors.New("malformed message")
+)
+
+// encodeMessage converts a message into a string that is sent to Redis.
+func encodeMessage(msg *types.Message) string {
+	if len(msg.Headers) == 0 && !bytes.HasPrefix(msg.Payload, []byte(wireMagic)) {
+		return string(msg.Payload)
+	}
+	keys := make([]string, 0, len(msg.Headers))
+	for k := range msg.Headers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	buf.WriteString(wireMagic)
+	writeUvarint(&buf, uint64(len(keys)))
+	for _, k := range keys {
+		writeString(&buf, k)
+		writeString(&buf, msg.Headers[k])
+	}
+	buf.Write(msg.Payload)
+	return buf.String()
+}
+
+// decodeMessage parses a string sent from Redis.
+func decodeMessage(topic, data string) (*types.Message, error) {
+	if len(data) < len(wireMagic) || data[:len(wireMagic)] != wireMagic {
+		return &types.Message{Topic: topic, Payload: []byte(data)}, nil
+	}
+	r := bytes.NewReader([]byte(data[len(wireMagic):]))
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, ErrMalformedMessage
+	}
+	if n > uint64(r.Len()) {
+		return nil, ErrMalformedMessage
+	}
+	var headers map[string]string
+	if n > 0 {
+		headers = make(map[string]string, n)
+	}
+	for i := uint64(0); i < n; i++ {
+		k, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		v, err := readString(r)
+		if err != nil {
+			return nil, err
+		}
+		headers[k] = v
+	}
+	payload := make([]byte, r.Len())
+	_, _ = r.Read(payload)
+	return &types.Message{Topic: topic, Headers: headers, Payload: payload}, nil
+}
+
+func writeUvarint(buf *bytes.Buffer, n uint64) {
+	var b [binary.MaxVarintLen64]byte
+	l := binary.PutUvarint(b[:], n)
+	buf.Write(b[:l])
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	writeUvarint(buf, uint64(len(s)))
+	buf.WriteString(s)
+}
+
+func readString(r *bytes.Reader) (string, error) {
+	l, err := binary.ReadUvarint(r)
+	if err != nil {
+		return "", ErrMalformedMessage
+	}
+	if l > uint64(r.Len()) {
+		return "", ErrMalformedMessage
+	}
+	b := make([]byte, l)
+	_, _ = r.Read(b)
+	return string(b), nil
+}
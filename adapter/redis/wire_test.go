@@ -0,0 +1,82 @@
+package redis
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/genkami/kiara/types"
+)
+
+var _ = Describe("Wire", func() {
+	topic := "kfpemployees"
+	payload := []byte("kikkeriki~~~")
+
+	Describe("encodeMessage", func() {
+		Context("when the message has no headers", func() {
+			It("encodes the message into the raw payload", func() {
+				encoded := encodeMessage(&types.Message{Topic: topic, Payload: payload})
+				Expect(encoded).To(Equal(string(payload)))
+			})
+		})
+
+		Context("when the message has no headers but its payload starts like a framed message", func() {
+			It("frames the message so that decodeMessage can parse it", func() {
+				msg := &types.Message{Topic: topic, Payload: []byte(wireMagic + "\x00raw")}
+				encoded := encodeMessage(msg)
+				Expect(encoded).NotTo(Equal(string(msg.Payload)))
+				decoded, err := decodeMessage(topic, encoded)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(decoded).To(Equal(msg))
+			})
+		})
+
+		Context("when the message has headers", func() {
+			It("encodes the message so that decodeMessage can parse it", func() {
+				msg := &types.Message{
+					Topic:   topic,
+					Headers: map[string]string{"Correlation-Id": "kfp-001", "Tenant-Id": ""},
+					Payload: payload,
+				}
+				decoded, err := decodeMessage(topic, encodeMessage(msg))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(decoded).To(Equal(msg))
+			})
+		})
+	})
+
+	Describe("decodeMessage", func() {
+		Context("when the data is a raw payload", func() {
+			It("returns a message without headers", func() {
+				decoded, err := decodeMessage(topic, string(payload))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(decoded).To(Equal(&types.Message{Topic: topic, Payload: payload}))
+			})
+		})
+
+		Context("when the data is truncated", func() {
+			It("returns an error", func() {
+				msg := &types.Message{
+					Topic:   topic,
+					Headers: map[string]string{"Correlation-Id": "kfp-001"},
+					Payload: payload,
+				}
+				encoded := encodeMessage(msg)
+				_, err := decodeMessage(topic, encoded[:len(wireMagic)+5])
+				Expect(err).To(MatchError(ErrMalformedMessage))
+			})
+		})
+	})
+
+	Describe("encodeScheduled", func() {
+		It("encodes the message together with its topic so that decodeScheduled can parse it", func() {
+			msg := &types.Message{
+				Topic:   topic,
+				Headers: map[string]string{types.HeaderMessageID: "kfp-001"},
+				Payload: payload,
+			}
+			decoded, err := decodeScheduled(encodeScheduled(msg))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(decoded).To(Equal(msg))
+		})
+	})
+})
@@ -0,0 +1,185 @@
+package kiara
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/genkami/kiara/types"
+)
+
+// backpressurePolicy determines what to do when a subscriber cannot receive messages as fast as they arrive.
+type backpressurePolicy int
+
+const (
+	policyDropNewest backpressurePolicy = iota
+	policyDropOldest
+	policyBlock
+	policyUnbounded
+)
+
+// backpressure is a backpressure policy together with its parameters.
+type backpressure struct {
+	policy  backpressurePolicy
+	timeout time.Duration // only for policyBlock
+}
+
+// queuedSink is a sink that queues messages and sends them to another sink in a dedicated goroutine,
+// so that waiting for a slow subscriber does not stall delivery to other subscriptions.
+// It is used for every backpressure policy except policyDropNewest, which does not need to wait at all.
+type queuedSink struct {
+	sink         sink
+	backpressure backpressure
+	capacity     int // the size of the ring buffer, or 0 if the queue is not a ring buffer
+	complete     func(*types.Message, error)
+
+	lock   sync.Mutex
+	queue  []queuedMessage
+	notify chan struct{}
+
+	// sending is true while `run` is sending a message that has already been removed from `queue`.
+	sending bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// queuedMessage is a message waiting in queuedSink.
+type queuedMessage struct {
+	d        delivery
+	deadline time.Time // only for policyBlock
+}
+
+// newQueuedSink wraps `s` with the given policy. It stops sending messages once `parent` is done.
+// `complete` is called with the result of delivering each message, including messages discarded
+// and ones remaining in the queue when the sink is closed.
+func newQueuedSink(parent context.Context, s sink, bp backpressure, capacity int, complete func(*types.Message, error)) *queuedSink {
+	if bp.policy != policyDropOldest {
+		// The queue is bounded only by the ring buffer of policyDropOldest.
+		// Messages are discarded by their deadlines instead when blocking.
+		capacity = 0
+	} else if capacity < 1 {
+		// The ring buffer keeps at least the latest message even if the channel is unbuffered.
+		capacity = 1
+	}
+	ctx, cancel := context.WithCancel(parent)
+	return &queuedSink{
+		sink:         s,
+		backpressure: bp,
+		capacity:     capacity,
+		complete:     complete,
+		notify:       make(chan struct{}, 1),
+		ctx:          ctx,
+		cancel:       cancel,
+		done:         make(chan struct{}),
+	}
+}
+
+// send queues a message. It never blocks regardless of `ctx`.
+// When the ring buffer overflows, the oldest message is discarded and reported in place of the given one.
+func (s *queuedSink) send(_ context.Context, d delivery) error {
+	s.lock.Lock()
+	var discarded *types.Message
+	if s.capacity > 0 && len(s.queue) >= s.capacity {
+		discarded = s.queue[0].d.msg
+		s.queue[0] = queuedMessage{}
+		s.queue = s.queue[1:]
+	}
+	m := queuedMessage{d: d}
+	if s.backpressure.policy == policyBlock {
+		m.deadline = time.Now().Add(s.backpressure.timeout)
+	}
+	s.queue = append(s.queue, m)
+	s.lock.Unlock()
+	select {
+	case s.notify <- struct{}{}:
+	default:
+		// `run` has already been notified.
+	}
+	if discarded != nil {
+		s.complete(discarded, ErrSlowConsumer)
+	}
+	return nil
+}
+
+// close stops sending messages and reports ErrSlowConsumer for messages remaining in the queue.
+func (s *queuedSink) close() {
+	s.cancel()
+	<-s.done
+	s.lock.Lock()
+	remaining := s.queue
+	s.queue = nil
+	s.lock.Unlock()
+	for _, m := range remaining {
+		s.complete(m.d.msg, ErrSlowConsumer)
+	}
+	s.sink.close()
+}
+
+// flush waits until all queued messages are sent, or returns ErrCancelled once `ctx` is done.
+func (s *queuedSink) flush(ctx context.Context) error {
+	ticker := time.NewTicker(publishQueuePollInterval)
+	defer ticker.Stop()
+	for !s.idle() {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ErrCancelled
+		}
+	}
+	return nil
+}
+
+// idle reports whether no messages are waiting to be sent.
+func (s *queuedSink) idle() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.queue) <= 0 && !s.sending
+}
+
+func (s *queuedSink) run() {
+	defer close(s.done)
+	for {
+		m, ok := s.dequeue()
+		if !ok {
+			select {
+			case <-s.notify:
+				continue
+			case <-s.ctx.Done():
+				return
+			}
+		}
+		err := s.sendOne(m)
+		s.complete(m.d.msg, err)
+		s.lock.Lock()
+		s.sending = false
+		s.lock.Unlock()
+		if s.ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+func (s *queuedSink) dequeue() (queuedMessage, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.queue) <= 0 {
+		return queuedMessage{}, false
+	}
+	m := s.queue[0]
+	s.queue[0] = queuedMessage{}
+	s.queue = s.queue[1:]
+	s.sending = true
+	return m, true
+}
+
+func (s *queuedSink) sendOne(m queuedMessage) error {
+	ctx := s.ctx
+	if s.backpressure.policy == policyBlock {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, m.deadline)
+		defer cancel()
+	}
+	return s.sink.send(ctx, m.d)
+}
@@ -0,0 +1,197 @@
+package kiara_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/genkami/kiara"
+	"github.com/genkami/kiara/adapter/inmemory"
+)
+
+var _ = Describe("Backpressure", func() {
+	var (
+		broker *inmemory.Broker
+		pubsub *kiara.PubSub
+	)
+
+	BeforeEach(func() {
+		broker = inmemory.NewBroker()
+		adapter := inmemory.NewAdapter(broker)
+		pubsub = kiara.NewPubSub(adapter)
+	})
+
+	AfterEach(func() {
+		pubsub.Close()
+		broker.Close()
+	})
+
+	publishAll := func(topic string, n int) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+		defer cancel()
+		for i := 0; i < n; i++ {
+			err := pubsub.Publish(ctx, topic, i)
+			Expect(err).NotTo(HaveOccurred())
+		}
+	}
+
+	expectSlowConsumer := func() {
+		select {
+		case err := <-pubsub.Errors():
+			Expect(err).To(MatchError(kiara.ErrSlowConsumer))
+		case <-time.After(timeoutExpectedNotToExceed):
+			Fail("timeout")
+		}
+	}
+
+	Describe("DropOldest", func() {
+		It("keeps the latest messages", func() {
+			topic := "room:123"
+			n := 5
+			sub, err := kiara.Subscribe[int](pubsub, topic, kiara.SubscriptionChannelSize(1), kiara.DropOldest())
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			publishAll(topic, n)
+			expectSlowConsumer()
+
+			var received []int
+			for len(received) == 0 || received[len(received)-1] != n-1 {
+				select {
+				case data := <-sub.Channel():
+					received = append(received, data)
+				case <-time.After(timeoutExpectedNotToExceed):
+					Fail("timeout")
+				}
+			}
+			Expect(len(received)).To(BeNumerically("<", n))
+		})
+
+		It("uses the capacity of the channel given to Subscribe as the size of the ring buffer", func() {
+			topic := "room:123"
+			n := 5
+			ch := make(chan int, 1)
+			sub, err := pubsub.Subscribe(topic, ch, kiara.DropOldest())
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			publishAll(topic, n)
+			expectSlowConsumer()
+		})
+	})
+
+	Describe("BlockWithTimeout", func() {
+		Context("when the subscriber receives messages before the timeout", func() {
+			It("delivers all messages in order", func() {
+				topic := "room:123"
+				n := 5
+				sub, err := kiara.Subscribe[int](pubsub, topic, kiara.SubscriptionChannelSize(1), kiara.BlockWithTimeout(timeoutExpectedNotToExceed))
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+				publishAll(topic, n)
+				for i := 0; i < n; i++ {
+					time.Sleep(timeoutExpectedToExceed)
+					select {
+					case data := <-sub.Channel():
+						Expect(data).To(Equal(i))
+					case <-time.After(timeoutExpectedNotToExceed):
+						Fail("timeout")
+					}
+				}
+				Consistently(pubsub.Errors(), timeoutExpectedToExceed).ShouldNot(Receive())
+			})
+		})
+
+		Context("when the subscriber does not receive messages", func() {
+			It("discards messages after the timeout", func() {
+				topic := "room:123"
+				sub, err := kiara.Subscribe[int](pubsub, topic, kiara.SubscriptionChannelSize(1), kiara.BlockWithTimeout(timeoutExpectedToExceed))
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+				publishAll(topic, 2)
+				expectSlowConsumer()
+			})
+		})
+
+		Context("when another subscription is subscribing to the same topic", func() {
+			It("does not stall delivery to the other", func() {
+				topic := "room:123"
+				n := 10
+				slow, err := kiara.Subscribe[int](pubsub, topic, kiara.SubscriptionChannelSize(1), kiara.BlockWithTimeout(time.Hour))
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(slow.Unsubscribe()).NotTo(HaveOccurred()) }()
+				fast, err := kiara.Subscribe[int](pubsub, topic)
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(fast.Unsubscribe()).NotTo(HaveOccurred()) }()
+				publishAll(topic, n)
+				for i := 0; i < n; i++ {
+					select {
+					case data := <-fast.Channel():
+						Expect(data).To(Equal(i))
+					case <-time.After(timeoutExpectedNotToExceed):
+						Fail("timeout")
+					}
+				}
+			})
+		})
+	})
+
+	Describe("UnboundedQueue", func() {
+		It("delivers all messages in order", func() {
+			topic := "room:123"
+			n := 500
+			sub, err := kiara.Subscribe[int](pubsub, topic, kiara.SubscriptionChannelSize(1), kiara.UnboundedQueue())
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			publishAll(topic, n)
+			for i := 0; i < n; i++ {
+				select {
+				case data := <-sub.Channel():
+					Expect(data).To(Equal(i))
+				case <-time.After(timeoutExpectedNotToExceed):
+					Fail("timeout")
+				}
+			}
+			Consistently(pubsub.Errors(), timeoutExpectedToExceed).ShouldNot(Receive())
+		})
+
+		Context("when the PubSub is shut down", func() {
+			It("delivers queued messages to the subscriber", func() {
+				topic := "room:123"
+				n := 5
+				ch := make(chan int, 1)
+				_, err := pubsub.Subscribe(topic, ch, kiara.UnboundedQueue())
+				Expect(err).NotTo(HaveOccurred())
+				publishAll(topic, n)
+				result := make(chan error, 1)
+				go func() {
+					ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+					defer cancel()
+					result <- pubsub.Shutdown(ctx)
+				}()
+				for i := 0; i < n; i++ {
+					Expect(receive(ch)).To(Equal(i))
+				}
+				Eventually(result).Should(Receive(BeNil()))
+				Expect(pubsub.Stats().Topics[topic].Delivered).To(Equal(uint64(n)))
+			})
+
+			It("reports messages that are not delivered before the context is done", func() {
+				topic := "room:123"
+				n := 5
+				ch := make(chan int, 1)
+				_, err := pubsub.Subscribe(topic, ch, kiara.UnboundedQueue())
+				Expect(err).NotTo(HaveOccurred())
+				publishAll(topic, n)
+				ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedToExceed)
+				defer cancel()
+				err = pubsub.Shutdown(ctx)
+				Expect(err).To(MatchError(kiara.ErrCancelled))
+				stats := pubsub.Stats().Topics[topic]
+				Expect(stats.Delivered).To(Equal(uint64(1)))
+				Expect(stats.Dropped).To(Equal(uint64(n - 1)))
+				expectSlowConsumer()
+			})
+		})
+	})
+})
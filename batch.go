@@ -0,0 +1,100 @@
+package kiara
+
+import (
+	"context"
+
+	"github.com/genkami/kiara/types"
+)
+
+// The length of the channel through which batches are sent to adapters that implement types.BatchAdapter.
+// Each batch may contain any number of messages, so this is much smaller than the default PublishChannelSize.
+const publishBatchChannelSize = 10
+
+// Outgoing is a message to be published by PubSub.PublishBatch.
+type Outgoing struct {
+	// Topic is the topic to which the message is published.
+	Topic string
+
+	// Data is the message, which is marshaled by the codec of the topic unless it is RawPayload.
+	Data interface{}
+
+	// Options configures publishing the message.
+	Options []PublishOption
+}
+
+// PublishBatch publishes all the given messages at once.
+// All messages are marshaled and go through the publish interceptors before any of them is published, and then
+// they are passed to the underlying adapter together if it implements types.BatchAdapter, so that it can send them to
+// the backend at once, e.g. by Redis pipelining or a single flush of NATS.
+//
+// Messages in a batch are published in the given order, but not necessarily in order with ones published by Publish
+// before or after the batch, since the adapter receives batches and single messages through different channels.
+// Publish preceding messages with PublishSync if they must be published before the batch.
+//
+// It returns an error without publishing any messages when it fails to marshal a message or an interceptor returns an error.
+// When `ctx` is done while waiting for the publish queue to have room, some of the messages may have been published.
+// Any other errors are reported asynchronously via PubSub.Errors() as Publish does.
+func (p *PubSub) PublishBatch(ctx context.Context, items []Outgoing) error {
+	msgs := make([]*types.Message, 0, len(items))
+	for _, item := range items {
+		opts := defaultPublishOptions()
+		for _, o := range item.Options {
+			o.applyPublish(&opts)
+		}
+		payload, err := marshal(p.opts.codecOf(item.Topic), item.Data)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, &types.Message{Topic: item.Topic, Headers: opts.headers, Payload: payload})
+	}
+	batch := make([]*types.Message, 0, len(msgs))
+	for _, msg := range msgs {
+		p.assignID(msg)
+		err := p.interceptPublish(ctx, msg, func(_ context.Context, msg *types.Message) error {
+			batch = append(batch, msg)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return p.enqueueBatch(ctx, batch)
+}
+
+// enqueueBatch sends messages to `publishBatchCh`, or to `publishCh` one by one if the adapter does not support batches.
+func (p *PubSub) enqueueBatch(ctx context.Context, msgs []*types.Message) error {
+	p.publishLock.RLock()
+	defer p.publishLock.RUnlock()
+	if p.closing {
+		return ErrClosed
+	}
+	adapter, ok := p.adapter.(types.BatchAdapter)
+	if !ok {
+		for _, msg := range msgs {
+			select {
+			case p.publishCh <- msg:
+			case <-ctx.Done():
+				return ErrCancelled
+			}
+			p.stats.published(msg.Topic)
+		}
+		return nil
+	}
+	size := adapter.MaxBatchSize()
+	for len(msgs) > 0 {
+		chunk := msgs
+		if size > 0 && len(chunk) > size {
+			chunk = chunk[:size]
+		}
+		select {
+		case p.publishBatchCh <- chunk:
+		case <-ctx.Done():
+			return ErrCancelled
+		}
+		for _, msg := range chunk {
+			p.stats.published(msg.Topic)
+		}
+		msgs = msgs[len(chunk):]
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package kiara_test
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/genkami/kiara"
+	"github.com/genkami/kiara/adapter/inmemory"
+	"github.com/genkami/kiara/types"
+)
+
+// batchSizeRecorder is a types.BatchAdapter that records the size of each batch.
+type batchSizeRecorder struct {
+	*inmemory.Adapter
+	maxBatchSize int
+	sizes        chan int
+	done         chan struct{}
+}
+
+func (a *batchSizeRecorder) MaxBatchSize() int {
+	return a.maxBatchSize
+}
+
+func (a *batchSizeRecorder) Start(pipe *types.Pipe) {
+	batches := make(chan []*types.Message)
+	go func() {
+		for {
+			select {
+			case msgs := <-pipe.PublishBatch:
+				a.sizes <- len(msgs)
+				batches <- msgs
+			case <-a.done:
+				return
+			}
+		}
+	}()
+	recorded := *pipe
+	recorded.PublishBatch = batches
+	a.Adapter.Start(&recorded)
+}
+
+func (a *batchSizeRecorder) Stop() {
+	close(a.done)
+	a.Adapter.Stop()
+}
+
+// nonBatchAdapter hides methods of the underlying adapter other than ones of types.Adapter.
+type nonBatchAdapter struct {
+	types.Adapter
+}
+
+var _ = Describe("PublishBatch", func() {
+	var (
+		broker *inmemory.Broker
+		pubsub *kiara.PubSub
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		broker = inmemory.NewBroker()
+		ctx, cancel = context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+	})
+
+	AfterEach(func() {
+		cancel()
+		pubsub.Close()
+		broker.Close()
+	})
+
+	It("publishes all messages with their options", func() {
+		pubsub = newPubSub(broker)
+		room := subscribe[kiara.Delivery[int]](pubsub, "room:123")
+		lobby := subscribe[kiara.Delivery[int]](pubsub, "lobby")
+		err := pubsub.PublishBatch(ctx, []kiara.Outgoing{
+			{Topic: "room:123", Data: 1},
+			{Topic: "lobby", Data: 2, Options: []kiara.PublishOption{kiara.WithHeaders(map[string]string{"Correlation-Id": "kfp-001"})}},
+			{Topic: "room:123", Data: 3},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(receive(room.Channel()).Value).To(Equal(1))
+		Expect(receive(room.Channel()).Value).To(Equal(3))
+		d := receive(lobby.Channel())
+		Expect(d.Value).To(Equal(2))
+		Expect(d.Headers).To(HaveKeyWithValue("Correlation-Id", "kfp-001"))
+		Expect(pubsub.Stats().Total.Published).To(Equal(uint64(3)))
+	})
+
+	Context("when a message cannot be marshaled", func() {
+		It("publishes none of the messages", func() {
+			pubsub = newPubSub(broker)
+			sub := subscribe[kiara.Delivery[int]](pubsub, "room:123")
+			err := pubsub.PublishBatch(ctx, []kiara.Outgoing{
+				{Topic: "room:123", Data: 1},
+				{Topic: "room:123", Data: func() {}},
+			})
+			Expect(err).To(HaveOccurred())
+			expectNoMessage(sub.Channel())
+		})
+	})
+
+	Context("when a publish interceptor returns an error", func() {
+		It("publishes none of the messages", func() {
+			rejected := errors.New("rejected")
+			pubsub = newPubSub(broker, kiara.WithPublishInterceptors(
+				func(ctx context.Context, msg *types.Message, next kiara.PublishFunc) error {
+					if msg.Topic == "forbidden" {
+						return rejected
+					}
+					return next(ctx, msg)
+				},
+			))
+			sub := subscribe[kiara.Delivery[int]](pubsub, "room:123")
+			err := pubsub.PublishBatch(ctx, []kiara.Outgoing{
+				{Topic: "room:123", Data: 1},
+				{Topic: "forbidden", Data: 2},
+			})
+			Expect(err).To(MatchError(rejected))
+			expectNoMessage(sub.Channel())
+		})
+	})
+
+	Context("when the batch is larger than the adapter accepts", func() {
+		It("splits the batch", func() {
+			adapter := &batchSizeRecorder{
+				Adapter:      inmemory.NewAdapter(broker),
+				maxBatchSize: 2,
+				sizes:        make(chan int, 10),
+				done:         make(chan struct{}),
+			}
+			pubsub = kiara.NewPubSub(adapter)
+			sub := subscribe[kiara.Delivery[int]](pubsub, "room:123")
+			items := make([]kiara.Outgoing, 0, 5)
+			for i := 0; i < cap(items); i++ {
+				items = append(items, kiara.Outgoing{Topic: "room:123", Data: i})
+			}
+			err := pubsub.PublishBatch(ctx, items)
+			Expect(err).NotTo(HaveOccurred())
+			for i := 0; i < len(items); i++ {
+				Expect(receive(sub.Channel()).Value).To(Equal(i))
+			}
+			Expect(adapter.sizes).To(HaveLen(3))
+			Expect([]int{<-adapter.sizes, <-adapter.sizes, <-adapter.sizes}).To(Equal([]int{2, 2, 1}))
+		})
+	})
+
+	Context("when the adapter does not support batches", func() {
+		It("publishes messages one by one", func() {
+			pubsub = kiara.NewPubSub(&nonBatchAdapter{Adapter: inmemory.NewAdapter(broker)})
+			sub := subscribe[kiara.Delivery[int]](pubsub, "room:123")
+			err := pubsub.PublishBatch(ctx, []kiara.Outgoing{
+				{Topic: "room:123", Data: 1},
+				{Topic: "room:123", Data: 2},
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(receive(sub.Channel()).Value).To(Equal(1))
+			Expect(receive(sub.Channel()).Value).To(Equal(2))
+		})
+	})
+})
@@ -0,0 +1,210 @@
+// Package compress provides a Codec that compresses payloads marshaled by another Codec.
+//
+// Only payloads larger than the threshold are compressed, and compressed payloads are marked so that they are
+// decompressed automatically regardless of the algorithm that the subscriber is configured with.
+// Payloads that are not marked are passed to the underlying Codec as they are.
+// Payloads that are not compressed are marked only if they could be mistaken for compressed ones.
+package compress
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/genkami/kiara/types"
+)
+
+var (
+	// This error is returned when a payload is compressed by an unsupported algorithm.
+	ErrUnknownAlgorithm = errors.New("unknown compression algorithm")
+
+	// This error is returned when a decompressed payload exceeds the limit given by MaxDecompressedSize.
+	ErrTooLarge = errors.New("decompressed payload is too large")
+)
+
+// Algorithm is a compression algorithm.
+type Algorithm byte
+
+const (
+	Gzip Algorithm = iota + 1
+	Zstd
+	Snappy
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case Gzip:
+		return "gzip"
+	case Zstd:
+		return "zstd"
+	case Snappy:
+		return "snappy"
+	default:
+		return fmt.Sprintf("Algorithm(%d)", byte(a))
+	}
+}
+
+// magic is the beginning of every compressed payload, followed by the Algorithm.
+//
+// Payloads of JSON, MessagePack and gob never start with 0xc1, but ones of Protocol Buffers or kiara.RawPayload
+// may start with magic by chance. Such payloads are marked as uncompressed when they are not compressed, so that
+// they are not mistaken for compressed ones.
+var magic = []byte{0xc1, 'K', 'Z'}
+
+// uncompressed follows magic in payloads that are marked but not compressed.
+const uncompressed Algorithm = 0
+
+// zstdEncoder is shared by all codecs since EncodeAll is safe for concurrent use.
+var zstdEncoder, _ = zstd.NewWriter(nil)
+
+type codec struct {
+	codec       types.Codec
+	algorithm   Algorithm
+	threshold   int
+	maxSize     int
+	zstdDecoder *zstd.Decoder
+}
+
+// NewCodec returns a Codec that compresses payloads marshaled by `c` with `algorithm`.
+// It panics if `algorithm` is not supported.
+func NewCodec(c types.Codec, algorithm Algorithm, options ...Option) types.Codec {
+	switch algorithm {
+	case Gzip, Zstd, Snappy:
+	default:
+		panic(fmt.Sprintf("compress: unsupported algorithm: %v", algorithm))
+	}
+	opts := defaultOptions()
+	for _, o := range options {
+		o.apply(&opts)
+	}
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(uint64(opts.maxSize)))
+	if err != nil {
+		// This never happens unless options are invalid.
+		panic(err)
+	}
+	return &codec{
+		codec:       c,
+		algorithm:   algorithm,
+		threshold:   opts.threshold,
+		maxSize:     opts.maxSize,
+		zstdDecoder: dec,
+	}
+}
+
+func (c *codec) Marshal(v interface{}) ([]byte, error) {
+	payload, err := c.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if len(payload) <= c.threshold {
+		return markUncompressed(payload), nil
+	}
+	compressed, err := c.compress(payload)
+	if err != nil {
+		return nil, err
+	}
+	if len(compressed) >= len(payload) {
+		// It is not worth it.
+		return markUncompressed(payload), nil
+	}
+	return compressed, nil
+}
+
+// markUncompressed marks `payload` as uncompressed if it could be mistaken for a compressed one.
+func markUncompressed(payload []byte) []byte {
+	if !bytes.HasPrefix(payload, magic) {
+		return payload
+	}
+	marked := make([]byte, 0, len(magic)+1+len(payload))
+	marked = append(marked, magic...)
+	marked = append(marked, byte(uncompressed))
+	return append(marked, payload...)
+}
+
+func (c *codec) Unmarshal(src []byte, v interface{}) error {
+	if !bytes.HasPrefix(src, magic) {
+		return c.codec.Unmarshal(src, v)
+	}
+	payload, err := c.decompress(src)
+	if err != nil {
+		return err
+	}
+	return c.codec.Unmarshal(payload, v)
+}
+
+func (c *codec) compress(payload []byte) ([]byte, error) {
+	header := append(append([]byte{}, magic...), byte(c.algorithm))
+	switch c.algorithm {
+	case Gzip:
+		buf := bytes.NewBuffer(header)
+		w := gzip.NewWriter(buf)
+		_, err := w.Write(payload)
+		if err != nil {
+			return nil, err
+		}
+		err = w.Close()
+		if err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case Zstd:
+		return zstdEncoder.EncodeAll(payload, header), nil
+	case Snappy:
+		return append(header, snappy.Encode(nil, payload)...), nil
+	default:
+		return nil, ErrUnknownAlgorithm
+	}
+}
+
+func (c *codec) decompress(src []byte) ([]byte, error) {
+	if len(src) <= len(magic) {
+		return nil, ErrUnknownAlgorithm
+	}
+	algorithm := Algorithm(src[len(magic)])
+	body := src[len(magic)+1:]
+	switch algorithm {
+	case uncompressed:
+		return body, nil
+	case Gzip:
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		payload, err := io.ReadAll(io.LimitReader(r, int64(c.maxSize)+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(payload) > c.maxSize {
+			return nil, ErrTooLarge
+		}
+		return payload, nil
+	case Zstd:
+		payload, err := c.zstdDecoder.DecodeAll(body, nil)
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+			return nil, ErrTooLarge
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(payload) > c.maxSize {
+			return nil, ErrTooLarge
+		}
+		return payload, nil
+	case Snappy:
+		n, err := snappy.DecodedLen(body)
+		if err != nil {
+			return nil, err
+		}
+		if n > c.maxSize {
+			return nil, ErrTooLarge
+		}
+		return snappy.Decode(nil, body)
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrUnknownAlgorithm, algorithm)
+	}
+}
@@ -0,0 +1,104 @@
+package compress_test
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/genkami/kiara/codec/compress"
+	"github.com/genkami/kiara/codec/internal/commontest"
+	json "github.com/genkami/kiara/codec/json"
+)
+
+type document struct {
+	Title string
+	Body  string
+}
+
+// bytesCodec is a Codec that uses []byte as the payload as it is.
+type bytesCodec struct{}
+
+func (bytesCodec) Marshal(v interface{}) ([]byte, error) {
+	return v.([]byte), nil
+}
+
+func (bytesCodec) Unmarshal(src []byte, v interface{}) error {
+	*v.(*[]byte) = append([]byte(nil), src...)
+	return nil
+}
+
+var _ = Describe("Compress", func() {
+	small := &document{Title: "hello", Body: "world"}
+	large := &document{Title: "kikkeriki", Body: strings.Repeat("a shark in the sea ", 1000)}
+
+	for _, algorithm := range []compress.Algorithm{compress.Gzip, compress.Zstd, compress.Snappy} {
+		algorithm := algorithm
+
+		Describe(algorithm.String(), func() {
+			codec := compress.NewCodec(json.Codec, algorithm)
+
+			Context("when the payload is larger than the threshold", func() {
+				It("compresses the payload", func() {
+					marshaled, err := codec.Marshal(large)
+					Expect(err).NotTo(HaveOccurred())
+					raw, err := json.Codec.Marshal(large)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(len(marshaled)).To(BeNumerically("<", len(raw)))
+
+					var unmarshaled document
+					err = codec.Unmarshal(marshaled, &unmarshaled)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(&unmarshaled).To(Equal(large))
+				})
+			})
+
+			Context("when the payload is not larger than the threshold", func() {
+				It("does not compress the payload", func() {
+					marshaled, err := codec.Marshal(small)
+					Expect(err).NotTo(HaveOccurred())
+					raw, err := json.Codec.Marshal(small)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(marshaled).To(Equal(raw))
+				})
+			})
+
+			Context("when the decompressed payload is too large", func() {
+				It("returns ErrTooLarge", func() {
+					marshaled, err := codec.Marshal(large)
+					Expect(err).NotTo(HaveOccurred())
+					limited := compress.NewCodec(json.Codec, algorithm, compress.MaxDecompressedSize(1024))
+					var unmarshaled document
+					err = limited.Unmarshal(marshaled, &unmarshaled)
+					Expect(err).To(MatchError(compress.ErrTooLarge))
+				})
+			})
+
+			commontest.AssertCodecCanMarshalAndUnmarshalAlmostEverything(compress.NewCodec(json.Codec, algorithm, compress.Threshold(0)))
+		})
+	}
+
+	Context("when the uncompressed payload looks like a compressed one", func() {
+		It("unmarshals it as it is", func() {
+			codec := compress.NewCodec(bytesCodec{}, compress.Gzip)
+			payload := []byte{0xc1, 'K', 'Z', byte(compress.Gzip), 'h', 'e', 'l', 'l', 'o'}
+			marshaled, err := codec.Marshal(payload)
+			Expect(err).NotTo(HaveOccurred())
+			var unmarshaled []byte
+			err = codec.Unmarshal(marshaled, &unmarshaled)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(unmarshaled).To(Equal(payload))
+		})
+	})
+
+	Context("when the payload is compressed by another algorithm", func() {
+		It("decompresses it automatically", func() {
+			marshaled, err := compress.NewCodec(json.Codec, compress.Zstd).Marshal(large)
+			Expect(err).NotTo(HaveOccurred())
+			var unmarshaled document
+			err = compress.NewCodec(json.Codec, compress.Gzip).Unmarshal(marshaled, &unmarshaled)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(&unmarshaled).To(Equal(large))
+		})
+	})
+})
@@ -0,0 +1,45 @@
+package compress
+
+const (
+	defaultThreshold           = 1024
+	defaultMaxDecompressedSize = 64 * 1024 * 1024
+)
+
+// options is a configuration of the compressing codec.
+type options struct {
+	threshold int
+	maxSize   int
+}
+
+func defaultOptions() options {
+	return options{
+		threshold: defaultThreshold,
+		maxSize:   defaultMaxDecompressedSize,
+	}
+}
+
+// Option configures the compressing codec.
+type Option interface {
+	apply(*options)
+}
+
+type optionFunc func(*options)
+
+func (f optionFunc) apply(opts *options) {
+	f(opts)
+}
+
+// Threshold sets the size in bytes above which payloads are compressed. The default is 1 KiB.
+func Threshold(size int) Option {
+	return optionFunc(func(opts *options) {
+		opts.threshold = size
+	})
+}
+
+// MaxDecompressedSize sets the maximum size in bytes of decompressed payloads in order to protect subscribers
+// from decompression bombs. Payloads that exceed it fail to be unmarshaled with ErrTooLarge. The default is 64 MiB.
+func MaxDecompressedSize(size int) Option {
+	return optionFunc(func(opts *options) {
+		opts.maxSize = size
+	})
+}
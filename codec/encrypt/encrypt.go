@@ -0,0 +1,200 @@
+// Package encrypt provides a Codec that encrypts payloads marshaled by another Codec.
+//
+// Payloads are sealed with AES-GCM or XChaCha20-Poly1305 together with the ID of the key, so that keys can be
+// rotated while messages encrypted with old keys can still be decrypted.
+package encrypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/genkami/kiara/types"
+)
+
+var (
+	// This error is returned when a payload is not encrypted.
+	ErrNotEncrypted = errors.New("not encrypted")
+
+	// This error is returned when a payload starts like an encrypted one but cannot be parsed.
+	ErrMalformed = errors.New("malformed encrypted payload")
+
+	// This error is returned when a payload is encrypted with a key that the codec does not have.
+	ErrUnknownKey = errors.New("unknown key")
+
+	// This error is returned when a payload fails to be authenticated, which means that it is tampered with
+	// or is encrypted with a different key that has the same ID.
+	ErrTampered = errors.New("payload is tampered")
+)
+
+// Algorithm is an AEAD algorithm to encrypt payloads.
+type Algorithm byte
+
+const (
+	// AESGCM is AES-GCM. The size of keys must be 16, 24 or 32 bytes.
+	AESGCM Algorithm = iota + 1
+
+	// XChaCha20Poly1305 is XChaCha20-Poly1305. The size of keys must be 32 bytes.
+	XChaCha20Poly1305
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case AESGCM:
+		return "AES-GCM"
+	case XChaCha20Poly1305:
+		return "XChaCha20-Poly1305"
+	default:
+		return fmt.Sprintf("Algorithm(%d)", byte(a))
+	}
+}
+
+// Key is a key to encrypt and decrypt payloads.
+type Key struct {
+	// ID identifies the key. It is embedded in encrypted payloads in plaintext, so it must not be secret.
+	ID string
+
+	// Algorithm is the algorithm that the key is used with.
+	Algorithm Algorithm
+
+	// Secret is the key itself.
+	Secret []byte
+}
+
+func (k Key) aead() (cipher.AEAD, error) {
+	switch k.Algorithm {
+	case AESGCM:
+		block, err := aes.NewCipher(k.Secret)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case XChaCha20Poly1305:
+		return chacha20poly1305.NewX(k.Secret)
+	default:
+		return nil, fmt.Errorf("unsupported algorithm: %v", k.Algorithm)
+	}
+}
+
+// magic is the beginning of every encrypted payload.
+// Since the codec never accepts plaintext, it only tells ErrNotEncrypted from the other errors.
+var magic = []byte{0xc1, 'K', 'X'}
+
+type sealer struct {
+	algorithm Algorithm
+	aead      cipher.AEAD
+}
+
+type codec struct {
+	codec   types.Codec
+	current string
+	keys    map[string]sealer
+}
+
+// NewCodec returns a Codec that encrypts payloads marshaled by `c` with `current`.
+// It can decrypt payloads encrypted with `current` or keys given by DecryptWith.
+//
+// It returns an error if any of the keys are invalid or have the same ID.
+func NewCodec(c types.Codec, current Key, options ...Option) (types.Codec, error) {
+	opts := defaultOptions()
+	for _, o := range options {
+		o.apply(&opts)
+	}
+	keys := make(map[string]sealer, len(opts.oldKeys)+1)
+	for _, key := range append([]Key{current}, opts.oldKeys...) {
+		if len(key.ID) > 255 {
+			return nil, fmt.Errorf("key ID is too long: %q", key.ID)
+		}
+		if _, ok := keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key ID: %q", key.ID)
+		}
+		aead, err := key.aead()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", key.ID, err)
+		}
+		keys[key.ID] = sealer{algorithm: key.Algorithm, aead: aead}
+	}
+	return &codec{codec: c, current: current.ID, keys: keys}, nil
+}
+
+// The format of encrypted payloads is: magic | algorithm | len(key ID) | key ID | nonce | ciphertext.
+// Everything before the nonce is authenticated as additional data.
+
+func (c *codec) Marshal(v interface{}) ([]byte, error) {
+	plaintext, err := c.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	s := c.keys[c.current]
+	header := make([]byte, 0, len(magic)+2+len(c.current))
+	header = append(header, magic...)
+	header = append(header, byte(s.algorithm), byte(len(c.current)))
+	header = append(header, c.current...)
+
+	nonceSize := s.aead.NonceSize()
+	buf := make([]byte, len(header)+nonceSize, len(header)+nonceSize+len(plaintext)+s.aead.Overhead())
+	copy(buf, header)
+	nonce := buf[len(header):]
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(buf, nonce, plaintext, header), nil
+}
+
+func (c *codec) Unmarshal(src []byte, v interface{}) error {
+	plaintext, err := c.open(src)
+	if err != nil {
+		return err
+	}
+	return c.codec.Unmarshal(plaintext, v)
+}
+
+func (c *codec) open(src []byte) ([]byte, error) {
+	algorithm, keyID, headerLen, err := parseHeader(src)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := c.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, keyID)
+	}
+	if s.algorithm != algorithm {
+		return nil, ErrTampered
+	}
+	header, rest := src[:headerLen], src[headerLen:]
+	nonceSize := s.aead.NonceSize()
+	if len(rest) < nonceSize+s.aead.Overhead() {
+		return nil, ErrMalformed
+	}
+	nonce, ciphertext := rest[:nonceSize], rest[nonceSize:]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, header)
+	if err != nil {
+		return nil, ErrTampered
+	}
+	return plaintext, nil
+}
+
+// KeyID returns the ID of the key that `payload` is encrypted with.
+// This is useful for interceptors that inspect messages without decrypting them.
+func KeyID(payload []byte) (string, error) {
+	_, keyID, _, err := parseHeader(payload)
+	return keyID, err
+}
+
+func parseHeader(src []byte) (algorithm Algorithm, keyID string, headerLen int, err error) {
+	if !bytes.HasPrefix(src, magic) {
+		return 0, "", 0, ErrNotEncrypted
+	}
+	rest := src[len(magic):]
+	if len(rest) < 2 || len(rest)-2 < int(rest[1]) {
+		return 0, "", 0, ErrMalformed
+	}
+	idLen := int(rest[1])
+	return Algorithm(rest[0]), string(rest[2 : 2+idLen]), len(magic) + 2 + idLen, nil
+}
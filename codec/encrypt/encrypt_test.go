@@ -0,0 +1,129 @@
+package encrypt_test
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/genkami/kiara/codec/encrypt"
+	"github.com/genkami/kiara/codec/internal/commontest"
+	json "github.com/genkami/kiara/codec/json"
+	"github.com/genkami/kiara/types"
+)
+
+type account struct {
+	Name string
+	Age  int
+}
+
+func newKey(id string, algorithm encrypt.Algorithm, b byte) encrypt.Key {
+	return encrypt.Key{ID: id, Algorithm: algorithm, Secret: bytes.Repeat([]byte{b}, 32)}
+}
+
+func mustNewCodec(c types.Codec, current encrypt.Key, options ...encrypt.Option) types.Codec {
+	codec, err := encrypt.NewCodec(c, current, options...)
+	Expect(err).NotTo(HaveOccurred())
+	return codec
+}
+
+var _ = Describe("Encrypt", func() {
+	data := &account{Name: "Gura", Age: 9927}
+
+	for _, algorithm := range []encrypt.Algorithm{encrypt.AESGCM, encrypt.XChaCha20Poly1305} {
+		algorithm := algorithm
+
+		Describe(algorithm.String(), func() {
+			key := newKey("key-1", algorithm, 1)
+
+			It("encrypts the payload", func() {
+				codec := mustNewCodec(json.Codec, key)
+				marshaled, err := codec.Marshal(data)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(marshaled)).NotTo(ContainSubstring("Gura"))
+				Expect(encrypt.KeyID(marshaled)).To(Equal("key-1"))
+
+				var unmarshaled account
+				err = codec.Unmarshal(marshaled, &unmarshaled)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(&unmarshaled).To(Equal(data))
+			})
+
+			Context("when the payload is tampered with", func() {
+				It("returns ErrTampered", func() {
+					codec := mustNewCodec(json.Codec, key)
+					marshaled, err := codec.Marshal(data)
+					Expect(err).NotTo(HaveOccurred())
+					marshaled[len(marshaled)-1] ^= 1
+					var unmarshaled account
+					err = codec.Unmarshal(marshaled, &unmarshaled)
+					Expect(err).To(MatchError(encrypt.ErrTampered))
+				})
+			})
+
+			Context("when the payload is encrypted with another key of the same ID", func() {
+				It("returns ErrTampered", func() {
+					marshaled, err := mustNewCodec(json.Codec, newKey("key-1", algorithm, 2)).Marshal(data)
+					Expect(err).NotTo(HaveOccurred())
+					var unmarshaled account
+					err = mustNewCodec(json.Codec, key).Unmarshal(marshaled, &unmarshaled)
+					Expect(err).To(MatchError(encrypt.ErrTampered))
+				})
+			})
+
+			commontest.AssertCodecCanMarshalAndUnmarshalAlmostEverything(mustNewCodec(json.Codec, key))
+		})
+	}
+
+	Context("when keys are rotated", func() {
+		oldKey := newKey("key-1", encrypt.AESGCM, 1)
+		currentKey := newKey("key-2", encrypt.XChaCha20Poly1305, 2)
+
+		It("decrypts payloads encrypted with old keys given by DecryptWith", func() {
+			marshaled, err := mustNewCodec(json.Codec, oldKey).Marshal(data)
+			Expect(err).NotTo(HaveOccurred())
+			rotated := mustNewCodec(json.Codec, currentKey, encrypt.DecryptWith(oldKey))
+			var unmarshaled account
+			err = rotated.Unmarshal(marshaled, &unmarshaled)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(&unmarshaled).To(Equal(data))
+
+			marshaled, err = rotated.Marshal(data)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(encrypt.KeyID(marshaled)).To(Equal("key-2"))
+		})
+
+		It("returns ErrUnknownKey for payloads encrypted with keys that are not given", func() {
+			marshaled, err := mustNewCodec(json.Codec, oldKey).Marshal(data)
+			Expect(err).NotTo(HaveOccurred())
+			var unmarshaled account
+			err = mustNewCodec(json.Codec, currentKey).Unmarshal(marshaled, &unmarshaled)
+			Expect(err).To(MatchError(encrypt.ErrUnknownKey))
+		})
+	})
+
+	Context("when the payload is not encrypted", func() {
+		It("returns ErrNotEncrypted", func() {
+			marshaled, err := json.Codec.Marshal(data)
+			Expect(err).NotTo(HaveOccurred())
+			var unmarshaled account
+			err = mustNewCodec(json.Codec, newKey("key-1", encrypt.AESGCM, 1)).Unmarshal(marshaled, &unmarshaled)
+			Expect(err).To(MatchError(encrypt.ErrNotEncrypted))
+		})
+	})
+
+	Context("when the key is invalid", func() {
+		It("returns an error", func() {
+			_, err := encrypt.NewCodec(json.Codec, encrypt.Key{ID: "key-1", Algorithm: encrypt.AESGCM, Secret: []byte("short")})
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("when keys have the same ID", func() {
+		It("returns an error", func() {
+			key := newKey("key-1", encrypt.AESGCM, 1)
+			_, err := encrypt.NewCodec(json.Codec, key, encrypt.DecryptWith(key))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -0,0 +1,29 @@
+package encrypt
+
+// options is a configuration of the encrypting codec.
+type options struct {
+	oldKeys []Key
+}
+
+func defaultOptions() options {
+	return options{}
+}
+
+// Option configures the encrypting codec.
+type Option interface {
+	apply(*options)
+}
+
+type optionFunc func(*options)
+
+func (f optionFunc) apply(opts *options) {
+	f(opts)
+}
+
+// DecryptWith adds keys that are only used to decrypt payloads.
+// Give keys that were used before rotation here until all messages encrypted with them are consumed.
+func DecryptWith(keys ...Key) Option {
+	return optionFunc(func(opts *options) {
+		opts.oldKeys = append(opts.oldKeys, keys...)
+	})
+}
@@ -0,0 +1,153 @@
+// Package envelope provides a Codec that wraps payloads in a self-describing envelope.
+//
+// An envelope records the content type of its body and the schema version of the data, so that subscribers that
+// accept more than one content type can choose the right codec to decode each message.
+package envelope
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/genkami/kiara/types"
+)
+
+var (
+	// This error is returned when a payload is not wrapped in an envelope.
+	ErrNotEnveloped = errors.New("not enveloped")
+
+	// This error is returned when a payload starts like an envelope but cannot be parsed.
+	ErrMalformed = errors.New("malformed envelope")
+
+	// This error is returned when no codecs are registered for the content type of an envelope.
+	ErrUnknownContentType = errors.New("unknown content type")
+)
+
+// Content types of codecs provided by kiara.
+const (
+	ContentTypeGob      = "application/x-gob"
+	ContentTypeJSON     = "application/json"
+	ContentTypeMsgpack  = "application/msgpack"
+	ContentTypeProtobuf = "application/protobuf"
+)
+
+// magic is the beginning of every envelope.
+// It only matters to AcceptUnwrapped: payloads of JSON, MessagePack and gob never start with 0xc1, so they are never
+// mistaken for envelopes, while ones of Protocol Buffers that happen to start with magic are.
+var magic = []byte{0xc1, 'K', 'E', 'V'}
+
+// formatVersion is the version of the envelope format itself, not of the data in it.
+const formatVersion = 1
+
+// Envelope is a parsed envelope.
+type Envelope struct {
+	// ContentType is the content type of Body.
+	ContentType string
+
+	// SchemaVersion is the version of the schema of the data that Body holds. It is zero if not specified.
+	SchemaVersion uint64
+
+	// Body is the data marshaled by the codec of ContentType.
+	Body []byte
+}
+
+// Parse parses an envelope. It returns ErrNotEnveloped if `payload` is not an envelope.
+// This is useful for interceptors that inspect messages without unmarshaling them.
+//
+// Note that Body shares the underlying array with `payload`.
+func Parse(payload []byte) (*Envelope, error) {
+	if !bytes.HasPrefix(payload, magic) {
+		return nil, ErrNotEnveloped
+	}
+	rest := payload[len(magic):]
+	if len(rest) < 1 || rest[0] != formatVersion {
+		return nil, ErrMalformed
+	}
+	rest = rest[1:]
+	typeLen, n := binary.Uvarint(rest)
+	if n <= 0 || uint64(len(rest)-n) < typeLen {
+		return nil, ErrMalformed
+	}
+	rest = rest[n:]
+	contentType := string(rest[:typeLen])
+	rest = rest[typeLen:]
+	schemaVersion, n := binary.Uvarint(rest)
+	if n <= 0 {
+		return nil, ErrMalformed
+	}
+	return &Envelope{ContentType: contentType, SchemaVersion: schemaVersion, Body: rest[n:]}, nil
+}
+
+// Bytes returns the wire format of the envelope.
+func (e *Envelope) Bytes() []byte {
+	buf := make([]byte, 0, len(magic)+1+2*binary.MaxVarintLen64+len(e.ContentType)+len(e.Body))
+	buf = append(buf, magic...)
+	buf = append(buf, formatVersion)
+	buf = appendUvarint(buf, uint64(len(e.ContentType)))
+	buf = append(buf, e.ContentType...)
+	buf = appendUvarint(buf, e.SchemaVersion)
+	buf = append(buf, e.Body...)
+	return buf
+}
+
+func appendUvarint(buf []byte, x uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], x)
+	return append(buf, tmp[:n]...)
+}
+
+type codec struct {
+	contentType   string
+	codec         types.Codec
+	schemaVersion uint64
+	accepted      map[string]types.Codec
+	unwrapped     types.Codec
+}
+
+// NewCodec returns a Codec that marshals data with `c` and wraps it in an envelope of `contentType`.
+//
+// It can unmarshal envelopes of `contentType` and the ones registered by Accept, regardless of the codec
+// used to marshal.
+func NewCodec(contentType string, c types.Codec, options ...Option) types.Codec {
+	opts := defaultOptions()
+	for _, o := range options {
+		o.apply(&opts)
+	}
+	accepted := make(map[string]types.Codec, len(opts.accepted)+1)
+	for ct, ac := range opts.accepted {
+		accepted[ct] = ac
+	}
+	accepted[contentType] = c
+	return &codec{
+		contentType:   contentType,
+		codec:         c,
+		schemaVersion: opts.schemaVersion,
+		accepted:      accepted,
+		unwrapped:     opts.unwrapped,
+	}
+}
+
+func (c *codec) Marshal(v interface{}) ([]byte, error) {
+	body, err := c.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	e := &Envelope{ContentType: c.contentType, SchemaVersion: c.schemaVersion, Body: body}
+	return e.Bytes(), nil
+}
+
+func (c *codec) Unmarshal(src []byte, v interface{}) error {
+	e, err := Parse(src)
+	if errors.Is(err, ErrNotEnveloped) && c.unwrapped != nil {
+		return c.unwrapped.Unmarshal(src, v)
+	}
+	if err != nil {
+		return err
+	}
+	dec, ok := c.accepted[e.ContentType]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownContentType, e.ContentType)
+	}
+	return dec.Unmarshal(e.Body, v)
+}
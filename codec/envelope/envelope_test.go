@@ -0,0 +1,103 @@
+package envelope_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/genkami/kiara/codec/envelope"
+	"github.com/genkami/kiara/codec/gob"
+	"github.com/genkami/kiara/codec/internal/commontest"
+	json "github.com/genkami/kiara/codec/json"
+	"github.com/genkami/kiara/codec/msgpack"
+)
+
+type account struct {
+	Name string
+	Age  int
+}
+
+var _ = Describe("Envelope", func() {
+	data := &account{Name: "Gura", Age: 9927}
+
+	Describe("Marshal", func() {
+		It("wraps data in an envelope", func() {
+			codec := envelope.NewCodec(envelope.ContentTypeJSON, json.Codec, envelope.SchemaVersion(3))
+			marshaled, err := codec.Marshal(data)
+			Expect(err).NotTo(HaveOccurred())
+			e, err := envelope.Parse(marshaled)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(e.ContentType).To(Equal(envelope.ContentTypeJSON))
+			Expect(e.SchemaVersion).To(Equal(uint64(3)))
+			var unmarshaled account
+			err = json.Codec.Unmarshal(e.Body, &unmarshaled)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(&unmarshaled).To(Equal(data))
+		})
+	})
+
+	Describe("Unmarshal", func() {
+		It("unmarshals envelopes of accepted content types", func() {
+			publisher := envelope.NewCodec(envelope.ContentTypeMsgpack, msgpack.Codec)
+			subscriber := envelope.NewCodec(envelope.ContentTypeJSON, json.Codec,
+				envelope.Accept(envelope.ContentTypeMsgpack, msgpack.Codec))
+			marshaled, err := publisher.Marshal(data)
+			Expect(err).NotTo(HaveOccurred())
+			var unmarshaled account
+			err = subscriber.Unmarshal(marshaled, &unmarshaled)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(&unmarshaled).To(Equal(data))
+		})
+
+		Context("when the content type is unknown", func() {
+			It("returns ErrUnknownContentType", func() {
+				publisher := envelope.NewCodec(envelope.ContentTypeMsgpack, msgpack.Codec)
+				subscriber := envelope.NewCodec(envelope.ContentTypeJSON, json.Codec)
+				marshaled, err := publisher.Marshal(data)
+				Expect(err).NotTo(HaveOccurred())
+				var unmarshaled account
+				err = subscriber.Unmarshal(marshaled, &unmarshaled)
+				Expect(err).To(MatchError(envelope.ErrUnknownContentType))
+			})
+		})
+
+		Context("when the payload is not wrapped", func() {
+			It("returns ErrNotEnveloped", func() {
+				marshaled, err := gob.Codec.Marshal(data)
+				Expect(err).NotTo(HaveOccurred())
+				var unmarshaled account
+				err = envelope.NewCodec(envelope.ContentTypeGob, gob.Codec).Unmarshal(marshaled, &unmarshaled)
+				Expect(err).To(MatchError(envelope.ErrNotEnveloped))
+			})
+
+			It("unmarshals it with the codec given by AcceptUnwrapped", func() {
+				marshaled, err := gob.Codec.Marshal(data)
+				Expect(err).NotTo(HaveOccurred())
+				var unmarshaled account
+				codec := envelope.NewCodec(envelope.ContentTypeJSON, json.Codec, envelope.AcceptUnwrapped(gob.Codec))
+				err = codec.Unmarshal(marshaled, &unmarshaled)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(&unmarshaled).To(Equal(data))
+			})
+		})
+	})
+
+	Describe("Parse", func() {
+		It("parses what Bytes returns", func() {
+			e := &envelope.Envelope{ContentType: "text/plain", SchemaVersion: 300, Body: []byte("kikkeriki")}
+			Expect(envelope.Parse(e.Bytes())).To(Equal(e))
+		})
+
+		Context("when the envelope is truncated", func() {
+			It("returns ErrMalformed", func() {
+				e := &envelope.Envelope{ContentType: "text/plain", SchemaVersion: 300}
+				b := e.Bytes()
+				for i := 5; i < len(b); i++ {
+					_, err := envelope.Parse(b[:i])
+					Expect(err).To(MatchError(envelope.ErrMalformed), "length: %d", i)
+				}
+			})
+		})
+	})
+
+	commontest.AssertCodecCanMarshalAndUnmarshalAlmostEverything(envelope.NewCodec(envelope.ContentTypeGob, gob.Codec))
+})
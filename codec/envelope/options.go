@@ -0,0 +1,52 @@
+package envelope
+
+import (
+	"github.com/genkami/kiara/types"
+)
+
+// options is a configuration of the envelope codec.
+type options struct {
+	schemaVersion uint64
+	accepted      map[string]types.Codec
+	unwrapped     types.Codec
+}
+
+func defaultOptions() options {
+	return options{
+		accepted: map[string]types.Codec{},
+	}
+}
+
+// Option configures the envelope codec.
+type Option interface {
+	apply(*options)
+}
+
+type optionFunc func(*options)
+
+func (f optionFunc) apply(opts *options) {
+	f(opts)
+}
+
+// SchemaVersion sets the schema version recorded in envelopes. The default is zero.
+func SchemaVersion(version uint64) Option {
+	return optionFunc(func(opts *options) {
+		opts.schemaVersion = version
+	})
+}
+
+// Accept makes the codec unmarshal envelopes of `contentType` with `c`.
+func Accept(contentType string, c types.Codec) Option {
+	return optionFunc(func(opts *options) {
+		opts.accepted[contentType] = c
+	})
+}
+
+// AcceptUnwrapped makes the codec unmarshal payloads that are not wrapped in envelopes with `c`,
+// e.g. ones published by PubSubs that have not been migrated to envelopes yet.
+// Otherwise, such payloads cannot be unmarshaled.
+func AcceptUnwrapped(c types.Codec) Option {
+	return optionFunc(func(opts *options) {
+		opts.unwrapped = c
+	})
+}
@@ -0,0 +1,174 @@
+// Package jsonschema provides a Codec for JSON that validates data against JSON Schemas.
+//
+// Schemas are registered for each Go type, or for all data. In order to use different schemas for different topics,
+// create a Codec for each topic and register it by kiara.WithTopicCodec or kiara.WithPatternCodec.
+package jsonschema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	schema "github.com/santhosh-tekuri/jsonschema/v5"
+
+	"github.com/genkami/kiara/types"
+)
+
+// ValidationError is returned when data does not conform to the schema.
+type ValidationError struct {
+	// Type is the Go type of the data being marshaled or unmarshaled.
+	Type reflect.Type
+
+	// Violations are the reasons why the data is invalid.
+	Violations []Violation
+
+	// Err is the error returned by the validator.
+	Err error
+}
+
+// Violation is a reason why data is invalid.
+type Violation struct {
+	// InstanceLocation is a JSON pointer to the invalid value in the data, e.g. `/items/0/name`.
+	InstanceLocation string
+
+	// KeywordLocation is a JSON pointer to the keyword in the schema that the value violates, e.g. `/properties/age/minimum`.
+	KeywordLocation string
+
+	// Message describes the violation.
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		messages = append(messages, fmt.Sprintf("%s: %s", location(v.InstanceLocation), v.Message))
+	}
+	return fmt.Sprintf("jsonschema: invalid %v: %s", e.Type, strings.Join(messages, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+func location(ptr string) string {
+	if ptr == "" {
+		return "/"
+	}
+	return ptr
+}
+
+func newValidationError(t reflect.Type, err error) error {
+	verr, ok := err.(*schema.ValidationError)
+	if !ok {
+		return err
+	}
+	return &ValidationError{Type: t, Violations: violationsOf(verr, nil), Err: err}
+}
+
+// violationsOf collects leaves of the tree of validation errors, which are the actual violations.
+func violationsOf(err *schema.ValidationError, violations []Violation) []Violation {
+	if len(err.Causes) == 0 {
+		return append(violations, Violation{
+			InstanceLocation: err.InstanceLocation,
+			KeywordLocation:  err.KeywordLocation,
+			Message:          err.Message,
+		})
+	}
+	for _, cause := range err.Causes {
+		violations = violationsOf(cause, violations)
+	}
+	return violations
+}
+
+type codec struct {
+	schemas  map[reflect.Type]*schema.Schema
+	fallback *schema.Schema
+}
+
+// NewCodec returns a Codec that converts data into JSON and validates it against schemas given by options,
+// both when it is marshaled and unmarshaled. Data that does not have a schema is not validated.
+//
+// It returns an error if any of the schemas are invalid.
+func NewCodec(options ...Option) (types.Codec, error) {
+	opts := defaultOptions()
+	for _, o := range options {
+		o.apply(&opts)
+	}
+	c := &codec{schemas: make(map[reflect.Type]*schema.Schema, len(opts.typeSchemas))}
+	var err error
+	if opts.schema != "" {
+		c.fallback, err = compile("schema.json", opts.schema)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for t, s := range opts.typeSchemas {
+		c.schemas[t], err = compile(t.String()+".json", s)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func compile(url, s string) (*schema.Schema, error) {
+	compiler := schema.NewCompiler()
+	err := compiler.AddResource(url, strings.NewReader(s))
+	if err != nil {
+		return nil, err
+	}
+	return compiler.Compile(url)
+}
+
+func (c *codec) Marshal(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	err = c.validate(v, data)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (c *codec) Unmarshal(src []byte, v interface{}) error {
+	err := c.validate(v, src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(src, v)
+}
+
+func (c *codec) validate(v interface{}, data []byte) error {
+	t := baseType(reflect.TypeOf(v))
+	s, ok := c.schemas[t]
+	if !ok {
+		s = c.fallback
+	}
+	if s == nil {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc interface{}
+	err := dec.Decode(&doc)
+	if err != nil {
+		return err
+	}
+	err = s.Validate(doc)
+	if err != nil {
+		return newValidationError(t, err)
+	}
+	return nil
+}
+
+// baseType strips pointers from `t` so that T, *T and **T share the same schema.
+func baseType(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
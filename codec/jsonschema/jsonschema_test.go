@@ -0,0 +1,119 @@
+package jsonschema_test
+
+import (
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/genkami/kiara/codec/internal/commontest"
+	"github.com/genkami/kiara/codec/jsonschema"
+	"github.com/genkami/kiara/types"
+)
+
+type account struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+type room struct {
+	ID string `json:"id"`
+}
+
+const accountSchema = `{
+	"type": "object",
+	"properties": {
+		"name": {"type": "string", "minLength": 1},
+		"age": {"type": "integer", "minimum": 0}
+	},
+	"required": ["name", "age"]
+}`
+
+func mustNewCodec(options ...jsonschema.Option) types.Codec {
+	codec, err := jsonschema.NewCodec(options...)
+	Expect(err).NotTo(HaveOccurred())
+	return codec
+}
+
+func expectViolations(err error, locations ...string) {
+	var validationErr *jsonschema.ValidationError
+	Expect(errors.As(err, &validationErr)).To(BeTrue(), "expected ValidationError but got %v", err)
+	actual := make([]string, 0, len(validationErr.Violations))
+	for _, v := range validationErr.Violations {
+		actual = append(actual, v.InstanceLocation)
+	}
+	Expect(actual).To(ConsistOf(locations))
+}
+
+var _ = Describe("Jsonschema", func() {
+	valid := &account{Name: "Gura", Age: 9927}
+	invalid := &account{Name: "", Age: -1}
+
+	Context("when TypeSchema is given", func() {
+		codec := mustNewCodec(jsonschema.TypeSchema[account](accountSchema))
+
+		Describe("Marshal", func() {
+			It("marshals valid data", func() {
+				marshaled, err := codec.Marshal(valid)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(marshaled).To(MatchJSON(`{"name": "Gura", "age": 9927}`))
+			})
+
+			It("rejects invalid data", func() {
+				_, err := codec.Marshal(invalid)
+				expectViolations(err, "/name", "/age")
+			})
+		})
+
+		Describe("Unmarshal", func() {
+			It("unmarshals valid data", func() {
+				var unmarshaled account
+				err := codec.Unmarshal([]byte(`{"name": "Gura", "age": 9927}`), &unmarshaled)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(&unmarshaled).To(Equal(valid))
+			})
+
+			It("rejects invalid data", func() {
+				var unmarshaled *account
+				err := codec.Unmarshal([]byte(`{"name": "Gura"}`), &unmarshaled)
+				expectViolations(err, "")
+				Expect(err.Error()).To(ContainSubstring("age"))
+			})
+		})
+
+		It("does not validate data of other types", func() {
+			marshaled, err := codec.Marshal(&room{})
+			Expect(err).NotTo(HaveOccurred())
+			var unmarshaled room
+			err = codec.Unmarshal(marshaled, &unmarshaled)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("when Schema is given", func() {
+		codec := mustNewCodec(
+			jsonschema.Schema(`{"type": "object", "required": ["id"]}`),
+			jsonschema.TypeSchema[account](accountSchema),
+		)
+
+		It("validates data that does not have its own schema", func() {
+			var unmarshaled room
+			err := codec.Unmarshal([]byte(`{}`), &unmarshaled)
+			expectViolations(err, "")
+		})
+
+		It("validates data that has its own schema with that schema", func() {
+			_, err := codec.Marshal(valid)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("when the schema is invalid", func() {
+		It("returns an error", func() {
+			_, err := jsonschema.NewCodec(jsonschema.Schema(`{"type": 1}`))
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	commontest.AssertCodecCanMarshalAndUnmarshalAlmostEverything(mustNewCodec())
+})
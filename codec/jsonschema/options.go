@@ -0,0 +1,44 @@
+package jsonschema
+
+import (
+	"reflect"
+)
+
+// options is a configuration of the validating codec.
+type options struct {
+	schema      string
+	typeSchemas map[reflect.Type]string
+}
+
+func defaultOptions() options {
+	return options{
+		typeSchemas: map[reflect.Type]string{},
+	}
+}
+
+// Option configures the validating codec.
+type Option interface {
+	apply(*options)
+}
+
+type optionFunc func(*options)
+
+func (f optionFunc) apply(opts *options) {
+	f(opts)
+}
+
+// Schema sets a JSON Schema that data is validated against unless its type has a schema given by TypeSchema.
+func Schema(schema string) Option {
+	return optionFunc(func(opts *options) {
+		opts.schema = schema
+	})
+}
+
+// TypeSchema sets a JSON Schema that data of type T is validated against.
+// Pointers to T share the same schema.
+func TypeSchema[T any](schema string) Option {
+	t := baseType(reflect.TypeOf((*T)(nil)).Elem())
+	return optionFunc(func(opts *options) {
+		opts.typeSchemas[t] = schema
+	})
+}
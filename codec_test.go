@@ -0,0 +1,88 @@
+package kiara_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/genkami/kiara"
+	"github.com/genkami/kiara/adapter/inmemory"
+	json "github.com/genkami/kiara/codec/json"
+)
+
+var _ = Describe("Per-topic codecs", func() {
+	var (
+		broker    *inmemory.Broker
+		publisher *kiara.PubSub
+		receiver  *kiara.PubSub
+	)
+
+	BeforeEach(func() {
+		broker = inmemory.NewBroker()
+		publisher = newPubSub(broker, kiara.WithPatternCodec("json:*", json.Codec))
+		receiver = newPubSub(broker)
+	})
+
+	AfterEach(func() {
+		publisher.Close()
+		receiver.Close()
+		broker.Close()
+	})
+
+	publish := func(topic string, data account) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+		defer cancel()
+		err := publisher.Publish(ctx, topic, data)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	sent := account{Name: "Gura", Age: 9927}
+
+	Context("when the topic matches a pattern", func() {
+		It("marshals and unmarshals messages with the codec of the pattern", func() {
+			sub, err := kiara.Subscribe[account](publisher, "json:123")
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			publish("json:123", sent)
+			Expect(receive(sub.Channel())).To(Equal(sent))
+		})
+
+		It("cannot be unmarshaled by the default codec", func() {
+			sub, err := kiara.Subscribe[account](receiver, "json:123")
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			publish("json:123", sent)
+			select {
+			case err := <-receiver.Errors():
+				var deliveryErr *kiara.DeliveryError
+				Expect(errors.As(err, &deliveryErr)).To(BeTrue())
+				Expect(deliveryErr.Topic).To(Equal("json:123"))
+			case <-time.After(timeoutExpectedNotToExceed):
+				Fail("timeout")
+			}
+		})
+	})
+
+	Context("when the topic does not match any pattern", func() {
+		It("uses the default codec", func() {
+			sub, err := kiara.Subscribe[account](receiver, "room:123")
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			publish("room:123", sent)
+			Expect(receive(sub.Channel())).To(Equal(sent))
+		})
+	})
+
+	Context("when SubscriptionCodec is given", func() {
+		It("unmarshals messages with the given codec", func() {
+			sub, err := kiara.Subscribe[account](receiver, "json:123", kiara.SubscriptionCodec(json.Codec))
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			publish("json:123", sent)
+			Expect(receive(sub.Channel())).To(Equal(sent))
+		})
+	})
+})
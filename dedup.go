@@ -0,0 +1,110 @@
+package kiara
+
+import (
+	"container/list"
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/genkami/kiara/types"
+)
+
+// idGenerator generates message IDs that consist of a random prefix unique to each PubSub and a sequence number.
+type idGenerator struct {
+	// seq must be accessed atomically, and must be placed at the beginning of the struct
+	// in order to be 64-bit aligned on 32-bit platforms.
+	seq    uint64
+	prefix string
+}
+
+func newIDGenerator() *idGenerator {
+	var prefix [12]byte
+	_, err := rand.Read(prefix[:])
+	if err != nil {
+		// This hardly happens, and IDs are still unique within the PubSub.
+		return &idGenerator{prefix: strconv.FormatInt(time.Now().UnixNano(), 36)}
+	}
+	return &idGenerator{prefix: hex.EncodeToString(prefix[:])}
+}
+
+func (g *idGenerator) next() string {
+	return g.prefix + "-" + strconv.FormatUint(atomic.AddUint64(&g.seq, 1), 36)
+}
+
+// assignID sets a new ID to `msg` unless it already has one, if WithMessageIDs is given.
+func (p *PubSub) assignID(msg *types.Message) {
+	if !p.opts.assignIDs {
+		return
+	}
+	if _, ok := msg.Headers[types.HeaderMessageID]; ok {
+		return
+	}
+	msg.SetHeader(types.HeaderMessageID, p.ids.next())
+}
+
+// isDuplicate reports whether the same message has already arrived, if deduplication is enabled.
+func (p *PubSub) isDuplicate(msg *types.Message) bool {
+	if p.dedup == nil {
+		return false
+	}
+	id, ok := msg.Headers[types.HeaderMessageID]
+	if !ok {
+		return false
+	}
+	// Adapters send the same message once for each pattern it matches in addition to the topic itself,
+	// and they are not duplicates of each other.
+	return p.dedup.seen(id+"\x00"+msg.Pattern, time.Now())
+}
+
+// deduplicator remembers keys that arrived within the window, up to the size.
+type deduplicator struct {
+	window time.Duration
+	size   int
+	keys   map[string]*list.Element
+	order  *list.List // of arrival, from the oldest
+}
+
+type arrival struct {
+	key string
+	at  time.Time
+}
+
+func newDeduplicator(window time.Duration, size int) *deduplicator {
+	return &deduplicator{
+		window: window,
+		size:   size,
+		keys:   make(map[string]*list.Element, size),
+		order:  list.New(),
+	}
+}
+
+// seen reports whether `key` has arrived before, and remembers it otherwise.
+func (d *deduplicator) seen(key string, now time.Time) bool {
+	d.forget(now)
+	if _, ok := d.keys[key]; ok {
+		return true
+	}
+	for d.order.Len() >= d.size {
+		d.remove(d.order.Front())
+	}
+	d.keys[key] = d.order.PushBack(arrival{key: key, at: now})
+	return false
+}
+
+// forget removes keys that arrived before the window.
+func (d *deduplicator) forget(now time.Time) {
+	for {
+		oldest := d.order.Front()
+		if oldest == nil || now.Sub(oldest.Value.(arrival).at) < d.window {
+			return
+		}
+		d.remove(oldest)
+	}
+}
+
+func (d *deduplicator) remove(e *list.Element) {
+	d.order.Remove(e)
+	delete(d.keys, e.Value.(arrival).key)
+}
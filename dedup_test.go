@@ -0,0 +1,113 @@
+package kiara_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/genkami/kiara"
+	"github.com/genkami/kiara/adapter/inmemory"
+	"github.com/genkami/kiara/types"
+)
+
+var _ = Describe("Message IDs", func() {
+	var (
+		broker *inmemory.Broker
+		pubsub *kiara.PubSub
+	)
+
+	topic := "room:123"
+
+	BeforeEach(func() {
+		broker = inmemory.NewBroker()
+	})
+
+	AfterEach(func() {
+		pubsub.Close()
+		broker.Close()
+	})
+
+	publish := func(data int, options ...kiara.PublishOption) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+		defer cancel()
+		err := pubsub.Publish(ctx, topic, data, options...)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	It("does not assign IDs by default", func() {
+		pubsub = newPubSub(broker)
+		sub := subscribe[kiara.Delivery[int]](pubsub, topic)
+		publish(1)
+		Expect(receive(sub.Channel()).Headers).To(BeNil())
+	})
+
+	Context("when WithMessageIDs is given", func() {
+		It("assigns a unique ID to each message", func() {
+			pubsub = newPubSub(broker, kiara.WithMessageIDs())
+			sub := subscribe[kiara.Delivery[int]](pubsub, topic)
+			publish(1)
+			publish(2)
+			first := receive(sub.Channel()).Headers[types.HeaderMessageID]
+			second := receive(sub.Channel()).Headers[types.HeaderMessageID]
+			Expect(first).NotTo(BeEmpty())
+			Expect(second).NotTo(BeEmpty())
+			Expect(first).NotTo(Equal(second))
+		})
+	})
+
+	Context("when WithMessageID is given", func() {
+		It("uses the given ID", func() {
+			pubsub = newPubSub(broker)
+			sub := subscribe[kiara.Delivery[int]](pubsub, topic)
+			publish(1, kiara.WithMessageID("kfp-001"))
+			Expect(receive(sub.Channel()).Headers).To(HaveKeyWithValue(types.HeaderMessageID, "kfp-001"))
+		})
+	})
+
+	Context("when WithDeduplication is given", func() {
+		It("discards duplicates", func() {
+			pubsub = newPubSub(broker, kiara.WithDeduplication(time.Minute, 100))
+			sub := subscribe[kiara.Delivery[int]](pubsub, topic)
+			publish(1, kiara.WithMessageID("kfp-001"))
+			publish(2, kiara.WithMessageID("kfp-001"))
+			publish(3, kiara.WithMessageID("kfp-002"))
+			Expect(receive(sub.Channel()).Value).To(Equal(1))
+			Expect(receive(sub.Channel()).Value).To(Equal(3))
+			expectNoMessage(sub.Channel())
+			Expect(pubsub.Stats().Topics[topic].Duplicates).To(Equal(uint64(1)))
+		})
+
+		It("delivers a message to both exact and pattern subscriptions", func() {
+			pubsub = newPubSub(broker, kiara.WithDeduplication(time.Minute, 100), kiara.WithMessageIDs())
+			exact := subscribe[kiara.Delivery[int]](pubsub, topic)
+			pattern := subscribe[kiara.Delivery[int]](pubsub, "room:*", kiara.AsPattern())
+			publish(1)
+			Expect(receive(exact.Channel()).Value).To(Equal(1))
+			Expect(receive(pattern.Channel()).Value).To(Equal(1))
+		})
+
+		It("forgets IDs after the window", func() {
+			window := 50 * time.Millisecond
+			pubsub = newPubSub(broker, kiara.WithDeduplication(window, 100))
+			sub := subscribe[kiara.Delivery[int]](pubsub, topic)
+			publish(1, kiara.WithMessageID("kfp-001"))
+			Expect(receive(sub.Channel()).Value).To(Equal(1))
+			time.Sleep(2 * window)
+			publish(2, kiara.WithMessageID("kfp-001"))
+			Expect(receive(sub.Channel()).Value).To(Equal(2))
+		})
+
+		It("forgets the oldest IDs when the size is exceeded", func() {
+			pubsub = newPubSub(broker, kiara.WithDeduplication(time.Minute, 1))
+			sub := subscribe[kiara.Delivery[int]](pubsub, topic)
+			publish(1, kiara.WithMessageID("kfp-001"))
+			publish(2, kiara.WithMessageID("kfp-002"))
+			publish(3, kiara.WithMessageID("kfp-001"))
+			Expect(receive(sub.Channel()).Value).To(Equal(1))
+			Expect(receive(sub.Channel()).Value).To(Equal(2))
+			Expect(receive(sub.Channel()).Value).To(Equal(3))
+		})
+	})
+})
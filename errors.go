@@ -0,0 +1,46 @@
+package kiara
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/genkami/kiara/types"
+)
+
+// PublishError is reported through PubSub.Errors() when the underlying adapter fails to publish a message.
+type PublishError = types.PublishError
+
+// DeliveryError is reported through PubSub.Errors() when a message cannot be delivered to a subscriber,
+// e.g. because the subscriber is too slow, the payload cannot be unmarshaled, or a handler returns an error.
+// The cause can be examined by errors.Is or errors.As.
+type DeliveryError struct {
+	// Topic is the topic of the message.
+	Topic string
+
+	// Subscription is the subscription to which the message was being delivered.
+	// It is nil when the underlying adapter failed to deliver the message before it reached the PubSub.
+	Subscription *Subscription
+
+	// Payload is the payload of the message. It may be nil when the message could not be received at all.
+	Payload []byte
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *DeliveryError) Error() string {
+	return fmt.Sprintf("failed to deliver a message from %q: %v", e.Topic, e.Err)
+}
+
+func (e *DeliveryError) Unwrap() error {
+	return e.Err
+}
+
+// fromAdapterError converts an error reported by the underlying adapter into an error reported through PubSub.Errors().
+func fromAdapterError(err error) error {
+	var deliveryErr *types.DeliveryError
+	if errors.As(err, &deliveryErr) {
+		return &DeliveryError{Topic: deliveryErr.Topic, Payload: deliveryErr.Payload, Err: deliveryErr.Err}
+	}
+	return err
+}
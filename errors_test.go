@@ -0,0 +1,164 @@
+package kiara_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/genkami/kiara"
+	"github.com/genkami/kiara/adapter/inmemory"
+	"github.com/genkami/kiara/types"
+)
+
+// brokenAdapter is an adapter that fails to deliver any messages that are published.
+type brokenAdapter struct {
+	failingAdapter
+}
+
+var errBroken = errors.New("broken")
+
+func (a *brokenAdapter) Start(pipe *types.Pipe) {
+	a.pipe = pipe
+	a.done = make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-a.done:
+				return
+			case msg := <-pipe.Publish:
+				msg.Complete(nil)
+				pipe.Errors <- &types.DeliveryError{Topic: msg.Topic, Payload: msg.Payload, Err: errBroken}
+			}
+		}
+	}()
+}
+
+var _ = Describe("Errors", func() {
+	receiveError := func(pubsub *kiara.PubSub) error {
+		select {
+		case err := <-pubsub.Errors():
+			return err
+		case <-time.After(timeoutExpectedNotToExceed):
+			Fail("timeout")
+			return nil
+		}
+	}
+
+	Context("when the PubSub fails to deliver a message", func() {
+		var (
+			broker *inmemory.Broker
+			pubsub *kiara.PubSub
+		)
+
+		BeforeEach(func() {
+			broker = inmemory.NewBroker()
+			adapter := inmemory.NewAdapter(broker)
+			pubsub = kiara.NewPubSub(adapter)
+		})
+
+		AfterEach(func() {
+			pubsub.Close()
+			broker.Close()
+		})
+
+		It("reports DeliveryError with the subscription when the subscriber is too slow", func() {
+			topic := "room:123"
+			sub, err := kiara.Subscribe[int](pubsub, topic, kiara.SubscriptionChannelSize(1))
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			for i := 0; i < 2; i++ {
+				err = pubsub.Publish(ctx, topic, i)
+				Expect(err).NotTo(HaveOccurred())
+			}
+
+			err = receiveError(pubsub)
+			Expect(err).To(MatchError(kiara.ErrSlowConsumer))
+			var deliveryErr *kiara.DeliveryError
+			Expect(errors.As(err, &deliveryErr)).To(BeTrue())
+			Expect(deliveryErr.Topic).To(Equal(topic))
+			Expect(deliveryErr.Subscription).To(BeIdenticalTo(sub.Subscription))
+			Expect(deliveryErr.Payload).NotTo(BeEmpty())
+		})
+
+		It("reports DeliveryError when the payload cannot be unmarshaled", func() {
+			topic := "room:123"
+			sub, err := kiara.Subscribe[account](pubsub, topic)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			err = pubsub.Publish(ctx, topic, "not an account")
+			Expect(err).NotTo(HaveOccurred())
+
+			err = receiveError(pubsub)
+			var deliveryErr *kiara.DeliveryError
+			Expect(errors.As(err, &deliveryErr)).To(BeTrue())
+			Expect(deliveryErr.Topic).To(Equal(topic))
+			Expect(deliveryErr.Subscription).To(BeIdenticalTo(sub.Subscription))
+		})
+
+		It("reports DeliveryError when a handler fails", func() {
+			topic := "room:123"
+			errHandler := errors.New("handler failed")
+			sub, err := kiara.SubscribeFunc(pubsub, topic, func(_ context.Context, _ int) error {
+				return errHandler
+			})
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			err = pubsub.Publish(ctx, topic, 1)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = receiveError(pubsub)
+			Expect(err).To(MatchError(errHandler))
+			var deliveryErr *kiara.DeliveryError
+			Expect(errors.As(err, &deliveryErr)).To(BeTrue())
+			Expect(deliveryErr.Topic).To(Equal(topic))
+			Expect(deliveryErr.Subscription).To(BeIdenticalTo(sub))
+		})
+	})
+
+	Context("when the adapter fails to publish a message", func() {
+		It("reports PublishError", func() {
+			pubsub := kiara.NewPubSub(&failingAdapter{})
+			defer pubsub.Close()
+			topic := "room:123"
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			err := pubsub.Publish(ctx, topic, 1)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = receiveError(pubsub)
+			Expect(err).To(MatchError(errPublishFailed))
+			var publishErr *kiara.PublishError
+			Expect(errors.As(err, &publishErr)).To(BeTrue())
+			Expect(publishErr.Topic).To(Equal(topic))
+		})
+	})
+
+	Context("when the adapter fails to deliver a message", func() {
+		It("reports DeliveryError without the subscription", func() {
+			pubsub := kiara.NewPubSub(&brokenAdapter{})
+			defer pubsub.Close()
+			topic := "room:123"
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			err := pubsub.Publish(ctx, topic, 1)
+			Expect(err).NotTo(HaveOccurred())
+
+			err = receiveError(pubsub)
+			Expect(err).To(MatchError(errBroken))
+			var deliveryErr *kiara.DeliveryError
+			Expect(errors.As(err, &deliveryErr)).To(BeTrue())
+			Expect(deliveryErr.Topic).To(Equal(topic))
+			Expect(deliveryErr.Subscription).To(BeNil())
+			Expect(deliveryErr.Payload).NotTo(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,101 @@
+package kiara_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/genkami/kiara"
+	"github.com/genkami/kiara/adapter/inmemory"
+	"github.com/genkami/kiara/types"
+)
+
+var _ = Describe("WithTTL", func() {
+	var (
+		broker *inmemory.Broker
+		pubsub *kiara.PubSub
+	)
+
+	topic := "presence:123"
+
+	BeforeEach(func() {
+		broker = inmemory.NewBroker()
+	})
+
+	AfterEach(func() {
+		pubsub.Close()
+		broker.Close()
+	})
+
+	Context("when the message does not expire before it is delivered", func() {
+		It("delivers the message together with its expiration", func() {
+			pubsub = newPubSub(broker)
+			sub, err := kiara.SubscribeDelivery[int](pubsub, topic)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			err = pubsub.Publish(ctx, topic, 1, kiara.WithTTL(time.Minute))
+			Expect(err).NotTo(HaveOccurred())
+			d := receive(sub.Channel())
+			Expect(d.Value).To(Equal(1))
+			Expect(d.Headers).To(HaveKey(types.HeaderExpiresAt))
+		})
+	})
+
+	Context("when the message expires before it is published", func() {
+		It("discards the message", func() {
+			pubsub = newPubSub(broker)
+			sub, err := kiara.Subscribe[int](pubsub, topic)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			err = pubsub.PublishSync(ctx, topic, 1, kiara.WithTTL(-time.Second))
+			Expect(err).To(MatchError(kiara.ErrExpired))
+			expectNoMessage(sub.Channel())
+			Expect(pubsub.Stats().Adapter.Expired).To(Equal(uint64(1)))
+		})
+	})
+
+	Context("when the message expires while waiting to be delivered", func() {
+		It("discards the message", func() {
+			// The interceptor holds the first message so that succeeding ones wait in the queue.
+			release := make(chan struct{})
+			held := make(chan struct{}, 1)
+			pubsub = newPubSub(broker, kiara.WithDeliveryInterceptors(func(ctx context.Context, sub *kiara.Subscription, msg *types.Message, next kiara.DeliverFunc) error {
+				select {
+				case held <- struct{}{}:
+					<-release
+				default:
+				}
+				return next(ctx, msg)
+			}))
+			sub, err := kiara.Subscribe[int](pubsub, topic)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+
+			ttl := 200 * time.Millisecond
+			err = pubsub.Publish(ctx, topic, 1)
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(held, timeoutExpectedNotToExceed).Should(HaveLen(1))
+			err = pubsub.Publish(ctx, topic, 2, kiara.WithTTL(ttl))
+			Expect(err).NotTo(HaveOccurred())
+			err = pubsub.Publish(ctx, topic, 3)
+			Expect(err).NotTo(HaveOccurred())
+			time.Sleep(2 * ttl)
+			close(release)
+
+			var received []int
+			for i := 0; i < 2; i++ {
+				received = append(received, receive(sub.Channel()))
+			}
+			Expect(received).To(Equal([]int{1, 3}))
+			Expect(pubsub.Stats().Topics[topic].Expired).To(Equal(uint64(1)))
+		})
+	})
+})
@@ -0,0 +1,150 @@
+package kiara
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"runtime/debug"
+
+	"github.com/genkami/kiara/types"
+)
+
+// PanicError is reported through PubSub.Errors() when a handler registered by SubscribeFunc or Respond panics.
+type PanicError struct {
+	// Value is the value passed to panic().
+	Value interface{}
+
+	// Stack is the stack trace of the goroutine that panicked.
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("handler panicked: %v", e.Value)
+}
+
+// SubscribeFunc subscribes to the given topic and handles messages with `handler`.
+// Messages are unmarshaled into T and handled by a pool of workers, whose size can be configured by Workers.
+//
+// Errors returned by `handler` are reported through PubSub.Errors() as *DeliveryError. If `handler` panics, the panic is recovered
+// and reported as *PanicError wrapped in *DeliveryError so that the worker can continue handling succeeding messages.
+//
+// The context passed to `handler` is cancelled once the returned Subscription is `Unsubscribe`d or the PubSub is closed,
+// and messages that are not handled by then are discarded.
+// The size of the queue of pending messages can be configured by SubscriptionChannelSize.
+func SubscribeFunc[T any](p *PubSub, topic string, handler func(ctx context.Context, data T) error, options ...SubscriptionOption) (*Subscription, error) {
+	opts := defaultSubscriptionOptions()
+	for _, o := range options {
+		o.applySubscription(&opts)
+	}
+	sink := newHandlerSink(p.ctx, handler, opts)
+	sub, err := p.subscribe([]string{topic}, sink, opts)
+	if err != nil {
+		return nil, err
+	}
+	sink.start(func(msg *types.Message, err error) {
+		p.reportDeliveryError(sub, msg, err)
+	})
+	return sub, nil
+}
+
+// handlerSink is a sink that handles messages with a handler registered by SubscribeFunc.
+type handlerSink[T any] struct {
+	handler func(context.Context, T) error
+	dec     decoder[T]
+	workers int
+
+	// queues has only one queue shared by all workers unless the order of messages is preserved.
+	// Otherwise, each worker has its own queue.
+	queues []chan delivered[T]
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// reportError reports an error that occurred while handling a message. It is set by `start`.
+	reportError func(*types.Message, error)
+}
+
+// delivered is a message waiting to be handled together with its unmarshaled payload.
+type delivered[T any] struct {
+	ctx  context.Context
+	msg  *types.Message
+	data T
+}
+
+// newHandlerSink returns a handlerSink whose workers stop handling messages once `parent` is done.
+func newHandlerSink[T any](parent context.Context, handler func(context.Context, T) error, opts subscriptionOptions) *handlerSink[T] {
+	workers := opts.workers
+	if workers < 1 {
+		workers = 1
+	}
+	numQueues := 1
+	if opts.preserveOrder {
+		numQueues = workers
+	}
+	queues := make([]chan delivered[T], numQueues)
+	for i := range queues {
+		queues[i] = make(chan delivered[T], opts.channelSize)
+	}
+	ctx, cancel := context.WithCancel(parent)
+	return &handlerSink[T]{
+		handler: handler,
+		dec:     newDecoder[T](),
+		workers: workers,
+		queues:  queues,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+func (s *handlerSink[T]) start(reportError func(*types.Message, error)) {
+	s.reportError = reportError
+	for i := 0; i < s.workers; i++ {
+		go s.run(s.queues[i%len(s.queues)])
+	}
+}
+
+func (s *handlerSink[T]) send(ctx context.Context, d delivery) error {
+	data, err := s.dec.decodeDelivery(d)
+	if err != nil {
+		return err
+	}
+	return sendTo(ctx, s.queueOf(d.msg.Topic), delivered[T]{ctx: d.ctx, msg: d.msg, data: data})
+}
+
+// queueOf returns a queue that messages of the given topic should be sent to.
+func (s *handlerSink[T]) queueOf(topic string) chan delivered[T] {
+	if len(s.queues) == 1 {
+		return s.queues[0]
+	}
+	h := fnv.New32a()
+	h.Write([]byte(topic))
+	return s.queues[h.Sum32()%uint32(len(s.queues))]
+}
+
+func (s *handlerSink[T]) close() {
+	s.cancel()
+	for _, q := range s.queues {
+		close(q)
+	}
+}
+
+func (s *handlerSink[T]) run(queue <-chan delivered[T]) {
+	for d := range queue {
+		if s.ctx.Err() != nil {
+			// unsubscribed; discard pending messages
+			continue
+		}
+		err := s.handle(d.ctx, d.data)
+		if err != nil {
+			s.reportError(d.msg, err)
+		}
+	}
+}
+
+func (s *handlerSink[T]) handle(ctx context.Context, data T) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return s.handler(ctx, data)
+}
@@ -0,0 +1,195 @@
+package kiara_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/genkami/kiara"
+	"github.com/genkami/kiara/adapter/inmemory"
+)
+
+var _ = Describe("SubscribeFunc", func() {
+	var (
+		broker *inmemory.Broker
+		pubsub *kiara.PubSub
+	)
+
+	BeforeEach(func() {
+		broker = inmemory.NewBroker()
+		adapter := inmemory.NewAdapter(broker)
+		pubsub = kiara.NewPubSub(adapter)
+	})
+
+	AfterEach(func() {
+		pubsub.Close()
+		broker.Close()
+	})
+
+	Context("when a message is published", func() {
+		It("calls the handler with the message", func() {
+			topic := "room:123"
+			received := make(chan account, 1)
+			sub, err := kiara.SubscribeFunc(pubsub, topic, func(_ context.Context, data account) error {
+				received <- data
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			sent := account{Name: "Gura", Age: 9927}
+			err = kiara.Publish(ctx, pubsub, topic, sent)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(receive(received)).To(Equal(sent))
+		})
+	})
+
+	Context("when the handler returns an error", func() {
+		It("reports the error", func() {
+			topic := "room:123"
+			errHandler := errors.New("handler failed")
+			sub, err := kiara.SubscribeFunc(pubsub, topic, func(_ context.Context, _ int) error {
+				return errHandler
+			})
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			err = pubsub.Publish(ctx, topic, 1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(receive(pubsub.Errors())).To(MatchError(errHandler))
+		})
+	})
+
+	Context("when the handler panics", func() {
+		It("reports the panic and continues handling succeeding messages", func() {
+			topic := "room:123"
+			received := make(chan int, 1)
+			sub, err := kiara.SubscribeFunc(pubsub, topic, func(_ context.Context, data int) error {
+				if data == 0 {
+					panic("kikkeriki")
+				}
+				received <- data
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			err = pubsub.Publish(ctx, topic, 0)
+			Expect(err).NotTo(HaveOccurred())
+			var panicErr *kiara.PanicError
+			Expect(errors.As(receive(pubsub.Errors()), &panicErr)).To(BeTrue())
+			Expect(panicErr.Value).To(Equal("kikkeriki"))
+
+			err = pubsub.Publish(ctx, topic, 1)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(receive(received)).To(Equal(1))
+		})
+	})
+
+	Context("when there are more than one workers", func() {
+		It("handles messages concurrently", func() {
+			topic := "room:123"
+			n := 4
+			var wg sync.WaitGroup
+			wg.Add(n)
+			sub, err := kiara.SubscribeFunc(pubsub, topic, func(_ context.Context, _ int) error {
+				// This never returns unless all messages are handled at the same time.
+				wg.Done()
+				wg.Wait()
+				return nil
+			}, kiara.Workers(n))
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			for i := 0; i < n; i++ {
+				err = pubsub.Publish(ctx, topic, i)
+				Expect(err).NotTo(HaveOccurred())
+			}
+			allDone := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(allDone)
+			}()
+			receive(allDone)
+		})
+	})
+
+	Context("when the order of messages is preserved", func() {
+		It("handles messages of the same topic in order", func() {
+			pattern := "room:*"
+			topics := []string{"room:1", "room:2", "room:3"}
+			n := 30
+			var lock sync.Mutex
+			handled := map[string][]int{}
+			var wg sync.WaitGroup
+			wg.Add(n * len(topics))
+			sub, err := kiara.SubscribeFunc(pubsub, pattern, func(_ context.Context, d message) error {
+				defer wg.Done()
+				lock.Lock()
+				defer lock.Unlock()
+				handled[d.Topic] = append(handled[d.Topic], d.Seq)
+				return nil
+			}, kiara.AsPattern(), kiara.Workers(4), kiara.PreserveTopicOrder())
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			for i := 0; i < n; i++ {
+				for _, topic := range topics {
+					err = pubsub.Publish(ctx, topic, message{Topic: topic, Seq: i})
+					Expect(err).NotTo(HaveOccurred())
+				}
+			}
+			allDone := make(chan struct{})
+			go func() {
+				wg.Wait()
+				close(allDone)
+			}()
+			receive(allDone)
+			lock.Lock()
+			defer lock.Unlock()
+			for _, topic := range topics {
+				Expect(handled[topic]).To(HaveLen(n), fmt.Sprintf("topic: %s", topic))
+				for i, seq := range handled[topic] {
+					Expect(seq).To(Equal(i), fmt.Sprintf("topic: %s", topic))
+				}
+			}
+		})
+	})
+
+	Context("when the subscription is unsubscribed", func() {
+		It("cancels the context passed to the handler", func() {
+			topic := "room:123"
+			started := make(chan struct{})
+			cancelled := make(chan struct{})
+			sub, err := kiara.SubscribeFunc(pubsub, topic, func(ctx context.Context, _ int) error {
+				close(started)
+				<-ctx.Done()
+				close(cancelled)
+				return nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			err = pubsub.Publish(ctx, topic, 1)
+			Expect(err).NotTo(HaveOccurred())
+			receive(started)
+			Expect(sub.Unsubscribe()).NotTo(HaveOccurred())
+			receive(cancelled)
+		})
+	})
+})
+
+// message is a message that remembers its topic and sequence number.
+type message struct {
+	Topic string
+	Seq   int
+}
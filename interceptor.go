@@ -0,0 +1,65 @@
+package kiara
+
+import (
+	"context"
+
+	"github.com/genkami/kiara/types"
+)
+
+// PublishFunc passes a message to the next PublishInterceptor, or to the underlying adapter if there are no more interceptors.
+type PublishFunc func(ctx context.Context, msg *types.Message) error
+
+// PublishInterceptor intercepts every message that is about to be published, after it is marshaled.
+//
+// It can inspect or modify `msg` and then must call `next` to continue publishing it.
+// It can also reject the message by returning an error without calling `next`, in which case the error is
+// returned from Publish, or drop the message silently by returning nil without calling `next`.
+type PublishInterceptor func(ctx context.Context, msg *types.Message, next PublishFunc) error
+
+// DeliverFunc passes a message to the next DeliveryInterceptor, or to the subscription if there are no more interceptors.
+// `ctx` becomes the context of the message that SubscribeFunc handlers, Respond handlers and Delivery.Context receive.
+type DeliverFunc func(ctx context.Context, msg *types.Message) error
+
+// DeliveryInterceptor intercepts every message that is about to be delivered to a subscription, before it is unmarshaled.
+// `sub` is nil when the message is a reply that arrived through the native request/reply mechanism of the adapter.
+// `ctx` is cancelled once `sub` is `Unsubscribe`d, or is the context passed to PubSub.Request when `sub` is nil.
+//
+// It can inspect or modify `msg` and then must call `next` to continue delivering it.
+// It can also pass a context derived from `ctx` to `next` in order to attach values to the message.
+// `msg` is a copy for each subscription, but its Headers and Payload are shared with other subscriptions,
+// so replace them (e.g. by types.Message.SetHeaders) instead of modifying them in place.
+// It can also reject the message by returning an error without calling `next`, in which case the error is
+// reported through PubSub.Errors() as *DeliveryError, or drop the message silently by returning nil without calling `next`.
+type DeliveryInterceptor func(ctx context.Context, sub *Subscription, msg *types.Message, next DeliverFunc) error
+
+// interceptPublish passes `msg` through the publish interceptors and finally to `last`.
+func (p *PubSub) interceptPublish(ctx context.Context, msg *types.Message, last PublishFunc) error {
+	return chainPublish(p.opts.publishInterceptors, ctx, msg, last)
+}
+
+func chainPublish(interceptors []PublishInterceptor, ctx context.Context, msg *types.Message, last PublishFunc) error {
+	if len(interceptors) == 0 {
+		return last(ctx, msg)
+	}
+	return interceptors[0](ctx, msg, func(ctx context.Context, msg *types.Message) error {
+		return chainPublish(interceptors[1:], ctx, msg, last)
+	})
+}
+
+// interceptDelivery passes `msg` through the delivery interceptors and finally to `last`.
+func (p *PubSub) interceptDelivery(ctx context.Context, sub *Subscription, msg *types.Message, last DeliverFunc) error {
+	if len(p.opts.deliveryInterceptors) == 0 {
+		return last(ctx, msg)
+	}
+	copied := *msg
+	return chainDelivery(p.opts.deliveryInterceptors, ctx, sub, &copied, last)
+}
+
+func chainDelivery(interceptors []DeliveryInterceptor, ctx context.Context, sub *Subscription, msg *types.Message, last DeliverFunc) error {
+	if len(interceptors) == 0 {
+		return last(ctx, msg)
+	}
+	return interceptors[0](ctx, sub, msg, func(ctx context.Context, msg *types.Message) error {
+		return chainDelivery(interceptors[1:], ctx, sub, msg, last)
+	})
+}
@@ -0,0 +1,214 @@
+package kiara_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/genkami/kiara"
+	"github.com/genkami/kiara/adapter/inmemory"
+	"github.com/genkami/kiara/types"
+)
+
+var _ = Describe("Interceptors", func() {
+	var (
+		broker *inmemory.Broker
+	)
+
+	BeforeEach(func() {
+		broker = inmemory.NewBroker()
+	})
+
+	AfterEach(func() {
+		broker.Close()
+	})
+
+	stampHeader := func(key, value string) kiara.PublishInterceptor {
+		return func(ctx context.Context, msg *types.Message, next kiara.PublishFunc) error {
+			headers := map[string]string{key: value}
+			for k, v := range msg.Headers {
+				headers[k] = v
+			}
+			msg.Headers = headers
+			return next(ctx, msg)
+		}
+	}
+
+	Describe("WithPublishInterceptors", func() {
+		Context("when an interceptor modifies the message", func() {
+			It("publishes the modified message", func() {
+				pubsub := newPubSub(broker, kiara.WithPublishInterceptors(stampHeader("Authorization", "birb")))
+				defer pubsub.Close()
+				topic := "room:123"
+				sub, err := kiara.SubscribeDelivery[int](pubsub, topic)
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+				ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+				defer cancel()
+				err = pubsub.Publish(ctx, topic, 123)
+				Expect(err).NotTo(HaveOccurred())
+				d := receive(sub.Channel())
+				Expect(d.Value).To(Equal(123))
+				Expect(d.Headers).To(HaveKeyWithValue("Authorization", "birb"))
+			})
+		})
+
+		Context("when more than one interceptor is given", func() {
+			It("calls them in order", func() {
+				var called []string
+				record := func(name string) kiara.PublishInterceptor {
+					return func(ctx context.Context, msg *types.Message, next kiara.PublishFunc) error {
+						called = append(called, name)
+						return next(ctx, msg)
+					}
+				}
+				pubsub := newPubSub(broker,
+					kiara.WithPublishInterceptors(record("first"), record("second")),
+					kiara.WithPublishInterceptors(record("third")),
+				)
+				defer pubsub.Close()
+				ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+				defer cancel()
+				err := pubsub.Publish(ctx, "room:123", 123)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(called).To(Equal([]string{"first", "second", "third"}))
+			})
+		})
+
+		Context("when an interceptor rejects the message", func() {
+			It("returns the error and does not publish the message", func() {
+				errRejected := errors.New("rejected")
+				pubsub := newPubSub(broker, kiara.WithPublishInterceptors(func(ctx context.Context, msg *types.Message, next kiara.PublishFunc) error {
+					return errRejected
+				}))
+				defer pubsub.Close()
+				topic := "room:123"
+				sub, err := kiara.Subscribe[int](pubsub, topic)
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+				ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+				defer cancel()
+				err = pubsub.Publish(ctx, topic, 123)
+				Expect(err).To(MatchError(errRejected))
+				Consistently(sub.Channel(), timeoutExpectedToExceed).ShouldNot(Receive())
+			})
+		})
+
+		Context("when an interceptor drops the message", func() {
+			It("does not make PublishSync wait", func() {
+				pubsub := newPubSub(broker, kiara.WithPublishInterceptors(func(ctx context.Context, msg *types.Message, next kiara.PublishFunc) error {
+					return nil
+				}))
+				defer pubsub.Close()
+				ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+				defer cancel()
+				err := pubsub.PublishSync(ctx, "room:123", 123)
+				Expect(err).NotTo(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("WithDeliveryInterceptors", func() {
+		Context("when an interceptor modifies the message", func() {
+			It("delivers the modified message only to the subscription", func() {
+				var first *kiara.Subscription
+				pubsub := newPubSub(broker, kiara.WithDeliveryInterceptors(func(ctx context.Context, sub *kiara.Subscription, msg *types.Message, next kiara.DeliverFunc) error {
+					if sub == first {
+						msg.Headers = map[string]string{"Intercepted": "yes"}
+					}
+					return next(ctx, msg)
+				}))
+				defer pubsub.Close()
+				topic := "room:123"
+				sub1, err := kiara.SubscribeDelivery[int](pubsub, topic)
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(sub1.Unsubscribe()).NotTo(HaveOccurred()) }()
+				first = sub1.Subscription
+				sub2, err := kiara.SubscribeDelivery[int](pubsub, topic)
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(sub2.Unsubscribe()).NotTo(HaveOccurred()) }()
+				ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+				defer cancel()
+				err = pubsub.Publish(ctx, topic, 123)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(receive(sub1.Channel()).Headers).To(HaveKeyWithValue("Intercepted", "yes"))
+				Expect(receive(sub2.Channel()).Headers).NotTo(HaveKey("Intercepted"))
+			})
+		})
+
+		Context("when an interceptor passes a derived context", func() {
+			type key struct{}
+			attach := kiara.WithDeliveryInterceptors(func(ctx context.Context, sub *kiara.Subscription, msg *types.Message, next kiara.DeliverFunc) error {
+				return next(context.WithValue(ctx, key{}, msg.Topic), msg)
+			})
+
+			It("makes the context available through Delivery", func() {
+				pubsub := newPubSub(broker, attach)
+				defer pubsub.Close()
+				topic := "room:123"
+				sub, err := kiara.SubscribeDelivery[int](pubsub, topic)
+				Expect(err).NotTo(HaveOccurred())
+				ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+				defer cancel()
+				err = pubsub.Publish(ctx, topic, 123)
+				Expect(err).NotTo(HaveOccurred())
+				d := receive(sub.Channel())
+				Expect(d.Context.Value(key{})).To(Equal(topic))
+
+				// The context is cancelled once unsubscribed.
+				Expect(d.Context.Err()).NotTo(HaveOccurred())
+				Expect(sub.Unsubscribe()).NotTo(HaveOccurred())
+				Expect(d.Context.Err()).To(HaveOccurred())
+			})
+
+			It("passes the context to handlers", func() {
+				pubsub := newPubSub(broker, attach)
+				defer pubsub.Close()
+				topic := "room:123"
+				values := make(chan interface{}, 1)
+				sub, err := kiara.SubscribeFunc(pubsub, topic, func(ctx context.Context, _ int) error {
+					values <- ctx.Value(key{})
+					return nil
+				})
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+				ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+				defer cancel()
+				err = pubsub.Publish(ctx, topic, 123)
+				Expect(err).NotTo(HaveOccurred())
+				Eventually(values, timeoutExpectedNotToExceed).Should(Receive(Equal(topic)))
+			})
+		})
+
+		Context("when an interceptor rejects the message", func() {
+			It("reports DeliveryError and does not deliver the message", func() {
+				errRejected := errors.New("rejected")
+				pubsub := newPubSub(broker, kiara.WithDeliveryInterceptors(func(ctx context.Context, sub *kiara.Subscription, msg *types.Message, next kiara.DeliverFunc) error {
+					return errRejected
+				}))
+				defer pubsub.Close()
+				topic := "room:123"
+				sub, err := kiara.Subscribe[int](pubsub, topic)
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+				ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+				defer cancel()
+				err = pubsub.Publish(ctx, topic, 123)
+				Expect(err).NotTo(HaveOccurred())
+				select {
+				case err := <-pubsub.Errors():
+					Expect(err).To(MatchError(errRejected))
+					var deliveryErr *kiara.DeliveryError
+					Expect(errors.As(err, &deliveryErr)).To(BeTrue())
+					Expect(deliveryErr.Subscription).To(BeIdenticalTo(sub.Subscription))
+				case <-time.After(timeoutExpectedNotToExceed):
+					Fail("timeout")
+				}
+				Consistently(sub.Channel(), timeoutExpectedToExceed).ShouldNot(Receive())
+			})
+		})
+	})
+})
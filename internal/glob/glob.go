@@ -0,0 +1,81 @@
+// Package glob matches topics against glob-style patterns.
+//
+// `*` matches any sequence of characters, `?` matches any single character, `[abc]`, `[^abc]` and `[a-z]` match
+// a single character in (or not in) the class, and `\` escapes the following character.
+package glob
+
+// Match reports whether `topic` matches the glob-style `pattern`.
+func Match(pattern, topic string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			// Try to match the rest of the pattern at every position.
+			for i := 0; i <= len(topic); i++ {
+				if Match(pattern[1:], topic[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(topic) == 0 {
+				return false
+			}
+			pattern, topic = pattern[1:], topic[1:]
+		case '[':
+			if len(topic) == 0 {
+				return false
+			}
+			rest, ok := matchClass(pattern[1:], topic[0])
+			if !ok {
+				return false
+			}
+			pattern, topic = rest, topic[1:]
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(topic) == 0 || pattern[0] != topic[0] {
+				return false
+			}
+			pattern, topic = pattern[1:], topic[1:]
+		}
+	}
+	return len(topic) == 0
+}
+
+// matchClass reports whether `c` matches a character class like `abc]`, `^abc]` or `a-z]` (without the leading `[`).
+// It returns the rest of the pattern after the closing `]`.
+func matchClass(pattern string, c byte) (string, bool) {
+	negate := false
+	if len(pattern) > 0 && pattern[0] == '^' {
+		negate = true
+		pattern = pattern[1:]
+	}
+	matched := false
+	for len(pattern) > 0 && pattern[0] != ']' {
+		lo := pattern[0]
+		if lo == '\\' && len(pattern) >= 2 {
+			pattern = pattern[1:]
+			lo = pattern[0]
+		}
+		hi := lo
+		if len(pattern) >= 3 && pattern[1] == '-' && pattern[2] != ']' {
+			hi = pattern[2]
+			pattern = pattern[2:]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+		}
+		if lo <= c && c <= hi {
+			matched = true
+		}
+		pattern = pattern[1:]
+	}
+	if len(pattern) > 0 {
+		// skip the closing `]`
+		pattern = pattern[1:]
+	}
+	return pattern, matched != negate
+}
@@ -0,0 +1,13 @@
+package glob_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestGlob(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Glob Suite")
+}
@@ -0,0 +1,42 @@
+package glob_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/genkami/kiara/internal/glob"
+)
+
+var _ = Describe("Glob", func() {
+	Describe("Match", func() {
+		cases := []struct {
+			pattern string
+			topic   string
+			matched bool
+		}{
+			{"room:123", "room:123", true},
+			{"room:123", "room:1234", false},
+			{"room:*", "room:123", true},
+			{"room:*", "room:", true},
+			{"room:*", "lobby:123", false},
+			{"*:123", "room:123", true},
+			{"r*m:*3", "room:123", true},
+			{"room:?", "room:1", true},
+			{"room:?", "room:12", false},
+			{"room:[12]", "room:1", true},
+			{"room:[12]", "room:3", false},
+			{"room:[^12]", "room:3", true},
+			{"room:[^12]", "room:1", false},
+			{"room:[0-9]", "room:5", true},
+			{"room:[0-9]", "room:a", false},
+			{"room:\\*", "room:*", true},
+			{"room:\\*", "room:1", false},
+		}
+		for _, c := range cases {
+			c := c
+			It("matches "+c.pattern+" against "+c.topic+" correctly", func() {
+				Expect(glob.Match(c.pattern, c.topic)).To(Equal(c.matched))
+			})
+		}
+	})
+})
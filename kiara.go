@@ -3,8 +3,8 @@ package kiara
 import (
 	"context"
 	"errors"
-	"reflect"
 	"sync"
+	"time"
 
 	"github.com/genkami/kiara/types"
 )
@@ -18,8 +18,27 @@ var (
 
 	// This error is returned when the second argument of PubSub.Subscribe() is not a channel or the direction of the channel is not <-.
 	ErrArgumentMustBeChannel = errors.New("argument must be a channel")
+
+	// This error is returned when subscribing to a pattern while the underlying adapter does not implement types.PatternAdapter.
+	ErrPatternNotSupported = errors.New("adapter does not support pattern subscriptions")
+
+	// This error is returned when publishing messages after the PubSub is closed.
+	ErrClosed = errors.New("pubsub is closed")
+
+	// This error is returned by PubSub.PublishSync when the message expires before it is published.
+	ErrExpired = types.ErrExpired
+
+	// This error is returned when subscribing to no topics.
+	ErrNoTopics = errors.New("no topics given")
+
+	// This error is returned by PubSub.Request when an interceptor drops the request or its reply.
+	ErrDropped = errors.New("dropped by an interceptor")
 )
 
+// This is the interval of checking whether the publish queue becomes empty while shutting down
+// if the adapter does not implement types.DrainAdapter.
+var publishQueuePollInterval = 10 * time.Millisecond
+
 // PubSub provides a way to send and receive arbitrary data.
 type PubSub struct {
 	adapter     types.Adapter
@@ -29,7 +48,34 @@ type PubSub struct {
 	errorCh     chan error
 	done        chan struct{}
 	doneWg      sync.WaitGroup
+	closeOnce   sync.Once
 	state       pubSubState
+	stats       *statsCollector
+	ids         *idGenerator
+
+	// dedup is nil unless WithDeduplication is given. It is only accessed by `run` and `drainDelivered`.
+	dedup *deduplicator
+
+	// publishBatchCh is a channel through which batches are sent to the adapter if it implements types.BatchAdapter.
+	publishBatchCh chan []*types.Message
+
+	// adapterErrorCh is a channel through which the adapter reports errors. They are forwarded to `errorCh` by `run`.
+	adapterErrorCh chan error
+
+	// ctx is cancelled once the PubSub is stopped so that subscriptions stop waiting for their subscribers.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// scheduleWake wakes up `runScheduler` when a message is scheduled.
+	scheduleWake      chan struct{}
+	schedulerCtx      context.Context
+	stopSchedulerFunc context.CancelFunc
+	schedulerDone     chan struct{}
+
+	// publishLock must be `RLock`ed while sending messages to `publishCh`
+	// so that no messages are sent after `closing` is set.
+	publishLock sync.RWMutex
+	closing     bool
 }
 
 // NewPubSub creates a new PubSub and starts its underlying adapter.
@@ -42,26 +88,47 @@ func NewPubSub(adapter types.Adapter, options ...Option) *PubSub {
 	publishCh := make(chan *types.Message, opts.publishChSize)
 	deliveredCh := make(chan *types.Message, opts.deliveredChSize)
 	errorCh := make(chan error, opts.errorChSize)
+	publishBatchCh := make(chan []*types.Message, publishBatchChannelSize)
+	adapterErrorCh := make(chan error, opts.errorChSize)
 	pipe := &types.Pipe{
-		Publish:   publishCh,
-		Delivered: deliveredCh,
-		Errors:    errorCh,
+		Publish:      publishCh,
+		PublishBatch: publishBatchCh,
+		Delivered:    deliveredCh,
+		Errors:       adapterErrorCh,
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
 	p := &PubSub{
-		adapter:     adapter,
-		opts:        opts,
-		publishCh:   publishCh,
-		deliveredCh: deliveredCh,
-		errorCh:     errorCh,
-		done:        make(chan struct{}),
+		adapter:        adapter,
+		opts:           opts,
+		publishCh:      publishCh,
+		deliveredCh:    deliveredCh,
+		errorCh:        errorCh,
+		publishBatchCh: publishBatchCh,
+		adapterErrorCh: adapterErrorCh,
+		done:           make(chan struct{}),
 		state: pubSubState{
-			subs: map[string]subscriptionSet{},
+			subs:        map[string]subscriptionSet{},
+			patternSubs: map[string]subscriptionSet{},
 		},
+		stats:  newStatsCollector(opts.replyTopicPrefix),
+		ids:    newIDGenerator(),
+		ctx:    ctx,
+		cancel: cancel,
+
+		scheduleWake:      make(chan struct{}, 1),
+		schedulerCtx:      schedulerCtx,
+		stopSchedulerFunc: stopScheduler,
+		schedulerDone:     make(chan struct{}),
+	}
+	if opts.dedupWindow > 0 && opts.dedupSize > 0 {
+		p.dedup = newDeduplicator(opts.dedupWindow, opts.dedupSize)
 	}
 	adapter.Start(pipe)
 	p.doneWg.Add(1)
 	go p.run()
+	go p.runScheduler()
 	return p
 }
 
@@ -73,93 +140,326 @@ func (p *PubSub) run() {
 			return
 		case msg := <-p.deliveredCh:
 			p.deliver(msg)
+		case err := <-p.adapterErrorCh:
+			p.reportError(fromAdapterError(err))
 		}
 	}
 }
 
 // Close stops the PubSub and releases its resources.
 // It also stop its underlying adapter so we don't need stopping adapters manually.
+// All subscriptions are `Unsubscribe`d, so channels owned by the PubSub are closed and handlers stop.
+// Messages that are not published or delivered yet are discarded. Use Shutdown to stop gracefully.
+// PublishSync waiting for a discarded message returns ErrClosed.
+// Messages scheduled by PublishAt or PublishAfter remain in the schedule store.
 func (p *PubSub) Close() {
+	p.closeOnce.Do(func() {
+		p.stopScheduler()
+		p.stopPublishing()
+		close(p.done)
+		p.doneWg.Wait()
+		p.cancel()
+		p.closeSubscriptions()
+		p.adapter.Stop()
+		p.discardQueued()
+	})
+}
+
+// Shutdown stops the PubSub gracefully.
+// It stops accepting new messages to publish, publishes all messages that are already queued, and delivers
+// messages that have already arrived to subscribers before stopping the PubSub and its underlying adapter.
+// This includes messages queued by backpressure policies such as UnboundedQueue, which are sent to subscribers
+// as soon as they receive ones before them.
+// Messages scheduled by PublishAt or PublishAfter remain in the schedule store.
+// All subscriptions are `Unsubscribe`d as Close does.
+//
+// It returns ErrCancelled if `ctx` is done before it finishes. Even in this case, the PubSub is stopped and remaining messages are discarded,
+// in which case PublishSync waiting for a discarded message returns ErrClosed, and messages queued by backpressure policies are
+// reported through PubSub.Errors() with ErrSlowConsumer.
+// It returns ErrClosed if the PubSub is already closed.
+func (p *PubSub) Shutdown(ctx context.Context) error {
+	err := ErrClosed
+	p.closeOnce.Do(func() {
+		err = p.shutdown(ctx)
+	})
+	return err
+}
+
+func (p *PubSub) shutdown(ctx context.Context) error {
+	p.stopScheduler()
+	p.stopPublishing()
+	err := p.drainAdapter(ctx)
 	close(p.done)
 	p.doneWg.Wait()
+	if err == nil {
+		err = p.drainDelivered(ctx)
+	}
+	if err == nil {
+		err = p.flushSubscriptions(ctx)
+	}
+	p.cancel()
+	p.closeSubscriptions()
 	p.adapter.Stop()
+	p.discardQueued()
+	return err
+}
+
+// stopPublishing makes succeeding Publish fail and waits for ongoing Publish to finish.
+func (p *PubSub) stopPublishing() {
+	p.publishLock.Lock()
+	defer p.publishLock.Unlock()
+	p.closing = true
+}
+
+// drainAdapter waits until the adapter finishes publishing all messages in the publish queue.
+func (p *PubSub) drainAdapter(ctx context.Context) error {
+	if adapter, ok := p.adapter.(types.DrainAdapter); ok {
+		err := adapter.Drain(ctx)
+		if err != nil && ctx.Err() != nil {
+			return ErrCancelled
+		}
+		return err
+	}
+	ticker := time.NewTicker(publishQueuePollInterval)
+	defer ticker.Stop()
+	for len(p.publishCh) > 0 || len(p.publishBatchCh) > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ErrCancelled
+		}
+	}
+	return nil
+}
+
+// discardQueued discards messages remaining in the publish queue and reports ErrClosed to their publishers.
+// This must be called after the adapter is stopped, so that publishers waiting in PublishSync do not wait forever.
+func (p *PubSub) discardQueued() {
+	for {
+		select {
+		case msg := <-p.publishCh:
+			msg.Complete(ErrClosed)
+		case msgs := <-p.publishBatchCh:
+			for _, msg := range msgs {
+				msg.Complete(ErrClosed)
+			}
+		default:
+			return
+		}
+	}
+}
+
+// flushSubscriptions waits until subscriptions send all messages queued by their backpressure policies to subscribers.
+// This must be called after `run` exits.
+func (p *PubSub) flushSubscriptions(ctx context.Context) error {
+	p.state.lock.RLock()
+	queued := make(map[*queuedSink]struct{})
+	for _, subsMap := range []map[string]subscriptionSet{p.state.subs, p.state.patternSubs} {
+		for _, subs := range subsMap {
+			subs.ForEach(func(sub *Subscription) {
+				if s, ok := sub.sink.(*queuedSink); ok {
+					queued[s] = struct{}{}
+				}
+			})
+		}
+	}
+	p.state.lock.RUnlock()
+	for s := range queued {
+		err := s.flush(ctx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// closeSubscriptions unsubscribes all subscriptions so that goroutines of their sinks finish and channels owned by the PubSub are closed.
+// This must be called after `ctx` is cancelled so that no more subscriptions are made.
+// The adapter is not told to unsubscribe since it is about to stop.
+func (p *PubSub) closeSubscriptions() {
+	p.state.lock.Lock()
+	defer p.state.lock.Unlock()
+	closed := newSubscriptionSet()
+	for _, subsMap := range []map[string]subscriptionSet{p.state.subs, p.state.patternSubs} {
+		for topic, subs := range subsMap {
+			subs.ForEach(closed.Add)
+			delete(subsMap, topic)
+		}
+	}
+	closed.ForEach(func(sub *Subscription) {
+		sub.cancel()
+		sub.sink.close()
+	})
 }
 
-// deliver delivers a message to all channels that are subscribing to a message's topic.
+// drainDelivered delivers all messages remaining in `deliveredCh`.
+// This must be called after `run` exits.
+func (p *PubSub) drainDelivered(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ErrCancelled
+		default:
+		}
+		select {
+		case msg := <-p.deliveredCh:
+			p.deliver(msg)
+		default:
+			return nil
+		}
+	}
+}
+
+// deliver delivers a message to all subscriptions that are subscribing to a message's topic,
+// or to a message's pattern if the message is delivered through a pattern subscription.
 func (p *PubSub) deliver(msg *types.Message) {
-	// Getting subscriptionSet and delivering messages to all its channels must be done with `state.lock` `RLock`ed
+	receivedAt := time.Now()
+	if msg.Expired(receivedAt) {
+		p.stats.expired(msg.Topic)
+		return
+	}
+	if p.isDuplicate(msg) {
+		p.stats.duplicated(msg.Topic)
+		return
+	}
+	// Getting subscriptionSet and delivering messages to all its subscriptions must be done with `state.lock` `RLock`ed
 	// in order to guarantee that no messages are sent after `Unsubscribe`d.
 	p.state.lock.RLock()
 	defer p.state.lock.RUnlock()
-	channels, ok := p.state.subs[msg.Topic]
+	var subs subscriptionSet
+	var ok bool
+	if msg.Pattern != "" {
+		subs, ok = p.state.patternSubs[msg.Pattern]
+	} else {
+		subs, ok = p.state.subs[msg.Topic]
+	}
 	if !ok {
 		return
 	}
-	channels = channels.Copy()
-	channels.ForEach(func(ch interface{}) {
-		p.deliverTo(ch, msg.Payload)
+	subs = subs.Copy()
+	subs.ForEach(func(sub *Subscription) {
+		p.deliverTo(sub, msg, receivedAt)
 	})
 }
 
-// deliverTo parses a message and delivers it to the given channel.
-// We do not share the parsed result with all channels that want the result in order
+// deliverTo parses a message and delivers it to the given subscription.
+// We do not share the parsed result with all subscriptions that want the result in order
 // to prevent the result from accidentally being accessed concurrently.
-func (p *PubSub) deliverTo(channel interface{}, payload []byte) {
-	chanVal := reflect.ValueOf(channel)
-	elemType := chanVal.Type().Elem()
-	var dataVal reflect.Value
-	if elemType.Kind() != reflect.Ptr {
-		dataVal = reflect.New(elemType)
-	} else {
-		dataVal = reflect.New(elemType.Elem())
-	}
-	// The type of `dataVal` is either `*elemType` or `elemType` itself here
-	// in order to avoid creating a pointer to pointer.
-	// Note that the type of `dataVal` is different from `elemType` if and
-	// only if `elemType.Kind() != reflect.Ptr`
-	err := p.opts.codec.Unmarshal(payload, dataVal.Interface())
-	if err != nil {
-		select {
-		case p.errorCh <- err:
-		default:
-			// discard
-		}
+func (p *PubSub) deliverTo(sub *Subscription, msg *types.Message, receivedAt time.Time) {
+	err := p.interceptDelivery(sub.ctx, sub, msg, func(ctx context.Context, msg *types.Message) error {
+		return sub.sink.send(noWait, delivery{ctx: ctx, codec: sub.codecOf(msg.Topic), msg: msg, receivedAt: receivedAt})
+	})
+	if _, ok := sub.sink.(*queuedSink); ok && err == nil {
+		// The message is just queued. queuedSink calls completeDelivery once it is actually delivered.
 		return
 	}
-	if elemType.Kind() != reflect.Ptr {
-		// As we described before, in this case the type of `dataVal` is
-		// `*elemType`. So we should `Indirect` it so that `dataVal` can be
-		// sent to `chanVal` (whose type is `chan<- elemType`).
-		dataVal = reflect.Indirect(dataVal)
+	p.completeDelivery(sub, msg, err)
+}
+
+// completeDelivery records the result of delivering `msg` to `sub`, and reports the error if any.
+func (p *PubSub) completeDelivery(sub *Subscription, msg *types.Message, err error) {
+	if err == nil {
+		p.stats.delivered(msg.Topic)
+		return
 	}
-	chosen, _, _ := reflect.Select([]reflect.SelectCase{
-		reflect.SelectCase{Dir: reflect.SelectSend, Chan: chanVal, Send: dataVal},
-		reflect.SelectCase{Dir: reflect.SelectDefault},
-	})
-	if chosen == 1 { // default:
-		select {
-		case p.errorCh <- ErrSlowConsumer:
-		default:
-			// discard
-		}
+	p.reportDeliveryError(sub, msg, err)
+}
+
+// reportDeliveryError reports an error that occurred while delivering `msg` to `sub`.
+func (p *PubSub) reportDeliveryError(sub *Subscription, msg *types.Message, err error) {
+	p.stats.failed(msg.Topic, err)
+	p.reportError(&DeliveryError{Topic: msg.Topic, Subscription: sub, Payload: msg.Payload, Err: err})
+}
+
+// reportError sends an error to PubSub.Errors() without blocking.
+func (p *PubSub) reportError(err error) {
+	select {
+	case p.errorCh <- err:
+	default:
+		// discard
 	}
 }
 
 // Publish publishes `data` to the underlying message broker.
 // This means `data` is sent to every channels that is `Subscribe`ing the same topic as the given one.
-// It returns an error when it cannot prepare publishing due to marshaling error or being cancelled by `ctx`.
+// It returns an error when it cannot prepare publishing due to marshaling error, being cancelled by `ctx`, or the PubSub being closed.
 // Any other errors are reported asynchronously via PubSub.Errors().
-func (p *PubSub) Publish(ctx context.Context, topic string, data interface{}) error {
-	payload, err := p.opts.codec.Marshal(data)
+//
+// If `data` is RawPayload, it is regarded as a pre-encoded payload and published as it is without being marshaled by the codec.
+func (p *PubSub) Publish(ctx context.Context, topic string, data interface{}, options ...PublishOption) error {
+	opts := defaultPublishOptions()
+	for _, o := range options {
+		o.applyPublish(&opts)
+	}
+	payload, err := marshal(p.opts.codecOf(topic), data)
+	if err != nil {
+		return err
+	}
+	msg := &types.Message{Topic: topic, Headers: opts.headers, Payload: payload}
+	return p.publishMessage(ctx, msg)
+}
+
+// PublishSync is the same as Publish except that it waits until the underlying adapter finishes publishing the message.
+// It returns an error that the adapter reported for the message, or ErrCancelled if `ctx` is done before the adapter finishes.
+// It returns ErrClosed if the PubSub is stopped before the adapter publishes the message.
+func (p *PubSub) PublishSync(ctx context.Context, topic string, data interface{}, options ...PublishOption) error {
+	opts := defaultPublishOptions()
+	for _, o := range options {
+		o.applyPublish(&opts)
+	}
+	payload, err := marshal(p.opts.codecOf(topic), data)
+	if err != nil {
+		return err
+	}
+	result := make(chan error, 1)
+	msg := &types.Message{Topic: topic, Headers: opts.headers, Payload: payload, Result: result}
+	err = p.publishMessage(ctx, msg)
 	if err != nil {
 		return err
 	}
-	msg := &types.Message{Topic: topic, Payload: payload}
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+		return ErrCancelled
+	}
+}
+
+// publishMessage sends an already marshaled message to the underlying adapter through the publish interceptors.
+func (p *PubSub) publishMessage(ctx context.Context, msg *types.Message) error {
+	_, err := p.publishIntercepted(ctx, msg)
+	return err
+}
+
+// publishIntercepted is the same as publishMessage except that it also reports whether an interceptor dropped the message.
+func (p *PubSub) publishIntercepted(ctx context.Context, msg *types.Message) (dropped bool, err error) {
+	p.assignID(msg)
+	enqueued := false
+	err = p.interceptPublish(ctx, msg, func(ctx context.Context, msg *types.Message) error {
+		enqueued = true
+		return p.enqueue(ctx, msg)
+	})
+	if err == nil && !enqueued {
+		// The message is dropped by an interceptor, so no one reports the result other than us.
+		msg.Complete(nil)
+		return true, nil
+	}
+	return false, err
+}
+
+// enqueue sends a message to `publishCh`.
+func (p *PubSub) enqueue(ctx context.Context, msg *types.Message) error {
+	p.publishLock.RLock()
+	defer p.publishLock.RUnlock()
+	if p.closing {
+		return ErrClosed
+	}
 	select {
 	case p.publishCh <- msg:
 	case <-ctx.Done():
 		return ErrCancelled
 	}
+	p.stats.published(msg.Topic)
 	return nil
 }
 
@@ -179,96 +479,236 @@ func (p *PubSub) Errors() <-chan error {
 // Note that PubSub internally passes *T to its internal codec when T is not a pointer.
 // In most cases you don't have to care about it but it may be confusing when the ccodec assumes that the data implements certain interfaces.
 //
+// `T` may also be Delivery[U], in which case the payload is unmarshaled into U and sent together with its metadata such as the topic.
+// If `T` is *types.Message or RawPayload, the message or its payload is sent as it is without being unmarshaled,
+// which is useful for proxies and bridges.
+//
 // It's ok to subscribe to one topic more than one times.
 // In this case, messages are broadcasted to all channels that are subscribing to the topic.
-func (p *PubSub) Subscribe(topic string, channel interface{}) (*Subscription, error) {
-	chanType := reflect.TypeOf(channel)
-	if chanType.Kind() != reflect.Chan {
-		return nil, ErrArgumentMustBeChannel
+// It returns ErrClosed if the PubSub is already closed.
+func (p *PubSub) Subscribe(topic string, channel interface{}, options ...SubscriptionOption) (*Subscription, error) {
+	return p.SubscribeTopics([]string{topic}, channel, options...)
+}
+
+// SubscribeTopics is the same as Subscribe except that it binds a channel to all the given topics at once.
+// Use Delivery as the element type of the channel to tell which topic each message comes from.
+// The returned Subscription stops receiving messages from all the topics once it is `Unsubscribe`d.
+//
+// When subscribing to patterns by AsPattern, note that a message is sent once for each pattern it matches.
+func (p *PubSub) SubscribeTopics(topics []string, channel interface{}, options ...SubscriptionOption) (*Subscription, error) {
+	opts := defaultSubscriptionOptions()
+	for _, o := range options {
+		o.applySubscription(&opts)
 	}
-	if chanType.ChanDir()&reflect.SendDir == 0 {
-		return nil, ErrArgumentMustBeChannel
+	sink, err := newReflectSink(channel)
+	if err != nil {
+		return nil, err
 	}
+	return p.subscribe(topics, sink, opts)
+}
 
+func (p *PubSub) subscribe(topics []string, sink sink, opts subscriptionOptions) (*Subscription, error) {
+	topics = uniqueTopics(topics)
+	if len(topics) <= 0 {
+		return nil, ErrNoTopics
+	}
 	p.state.lock.Lock()
 	defer p.state.lock.Unlock()
-	alreadySubscribed := false
-	channels, ok := p.state.subs[topic]
-	if !ok {
-		channels = newSubscriptionSet()
-		p.state.subs[topic] = channels
-	}
-	if len(channels) > 0 {
-		alreadySubscribed = true
-	}
-	channels.Add(channel)
-	if !alreadySubscribed {
-		// this must be called with `state.lock` locked in order to avoid
-		// race condition where all channels are removed from `state.subs` but
-		// `p` continues subscribing to the topic.
-		err := p.adapter.Subscribe(topic)
-		if err != nil {
-			return nil, err
-		}
+	if p.ctx.Err() != nil {
+		// The subscription would never be closed by closeSubscriptions.
+		return nil, ErrClosed
 	}
-	return &Subscription{
-		topic:   topic,
-		channel: channel,
+	ctx, cancel := context.WithCancel(p.ctx)
+	sub := &Subscription{
+		topics:  topics,
+		pattern: opts.pattern,
+		sink:    sink,
 		pubSub:  p,
-	}, nil
+		codec:   opts.codec,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	var queued *queuedSink
+	if opts.backpressure.policy != policyDropNewest {
+		capacity := opts.channelSize
+		if s, ok := sink.(*reflectSink); ok {
+			// The channel is made by the user, so SubscriptionChannelSize does not apply to it.
+			capacity = s.chanVal.Cap()
+		}
+		queued = newQueuedSink(p.ctx, sink, opts.backpressure, capacity, func(msg *types.Message, err error) {
+			p.completeDelivery(sub, msg, err)
+		})
+		sub.sink = queued
+	}
+	subsMap := p.state.subsMapOf(sub)
+	for i, topic := range topics {
+		subs, ok := subsMap[topic]
+		if !ok {
+			// this must be called with `state.lock` locked in order to avoid
+			// race condition where all subscriptions are removed from `state.subs` but
+			// `p` continues subscribing to the topic.
+			err := p.subscribeAdapter(sub.pattern, topic)
+			if err != nil {
+				// The subscription must not remain subscribing to the topics before this.
+				for _, emptied := range p.state.removeSubscription(sub, topics[:i]) {
+					_ = p.unsubscribeAdapter(sub.pattern, emptied)
+				}
+				cancel()
+				return nil, err
+			}
+			subs = newSubscriptionSet()
+			subsMap[topic] = subs
+		}
+		subs.Add(sub)
+	}
+	if queued != nil {
+		go queued.run()
+	}
+	return sub, nil
 }
 
-func (p *PubSub) unsubscribe(topic string, channel interface{}) error {
+func (p *PubSub) unsubscribe(sub *Subscription) error {
 	p.state.lock.Lock()
 	defer p.state.lock.Unlock()
-	channels, ok := p.state.subs[topic]
-	if !ok {
+	if !p.state.has(sub) {
 		return nil
 	}
-	channels.Delete(channel)
-	if channels.Len() <= 0 {
-		delete(p.state.subs, topic)
-		// this must be called with `state.lock` locked in order to avoid
-		// race condition where some channels are added to `state.subs` but
-		// `p` stops subscribing to the topic.
+	emptied := p.state.removeSubscription(sub, sub.topics)
+	// No more messages are sent to `sub` because `deliver` holds `state.lock` while sending.
+	sub.cancel()
+	sub.sink.close()
+	// this must be called with `state.lock` locked in order to avoid
+	// race condition where some subscriptions are added to `state.subs` but
+	// `p` stops subscribing to the topic.
+	var firstErr error
+	for _, topic := range emptied {
+		err := p.unsubscribeAdapter(sub.pattern, topic)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (p *PubSub) subscribeAdapter(pattern bool, topic string) error {
+	if !pattern {
+		return p.adapter.Subscribe(topic)
+	}
+	adapter, ok := p.adapter.(types.PatternAdapter)
+	if !ok {
+		return ErrPatternNotSupported
+	}
+	return adapter.SubscribePattern(topic)
+}
+
+func (p *PubSub) unsubscribeAdapter(pattern bool, topic string) error {
+	if !pattern {
 		return p.adapter.Unsubscribe(topic)
 	}
-	return nil
+	// We have already checked that the adapter implements types.PatternAdapter in `subscribeAdapter`.
+	return p.adapter.(types.PatternAdapter).UnsubscribePattern(topic)
+}
+
+// uniqueTopics returns topics without duplicates, keeping their order.
+func uniqueTopics(topics []string) []string {
+	seen := make(map[string]struct{}, len(topics))
+	unique := make([]string, 0, len(topics))
+	for _, topic := range topics {
+		if _, ok := seen[topic]; ok {
+			continue
+		}
+		seen[topic] = struct{}{}
+		unique = append(unique, topic)
+	}
+	return unique
 }
 
 // pubSubState is an internal state of PubSub that cannot be accessed concurrently.
 type pubSubState struct {
-	lock sync.RWMutex
-	subs map[string]subscriptionSet
+	lock        sync.RWMutex
+	subs        map[string]subscriptionSet
+	patternSubs map[string]subscriptionSet
+}
+
+// subsMapOf returns a map that `sub` should belong to.
+func (s *pubSubState) subsMapOf(sub *Subscription) map[string]subscriptionSet {
+	if sub.pattern {
+		return s.patternSubs
+	}
+	return s.subs
+}
+
+// has reports whether `sub` is subscribing to its topics.
+func (s *pubSubState) has(sub *Subscription) bool {
+	subs, ok := s.subsMapOf(sub)[sub.topics[0]]
+	return ok && subs.Has(sub)
+}
+
+// removeSubscription removes `sub` from the given topics and returns topics that no longer have subscriptions.
+func (s *pubSubState) removeSubscription(sub *Subscription, topics []string) []string {
+	subsMap := s.subsMapOf(sub)
+	var emptied []string
+	for _, topic := range topics {
+		subs, ok := subsMap[topic]
+		if !ok {
+			continue
+		}
+		subs.Delete(sub)
+		if subs.Len() <= 0 {
+			delete(subsMap, topic)
+			emptied = append(emptied, topic)
+		}
+	}
+	return emptied
 }
 
 // Subscription binds a channel to specific topic.
 type Subscription struct {
-	topic   string
-	channel interface{} // guaranteed to be a channel
+	topics  []string // or patterns if `pattern` is true
+	pattern bool
+	sink    sink
 	pubSub  *PubSub
+
+	// codec overrides the codec of the PubSub if not nil.
+	codec types.Codec
+
+	// ctx is the root of contexts of messages delivered to the subscription. It is cancelled once `Unsubscribe`d.
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // Unsubscribe removes a binding from corresponding channel to its associated topic.
 // Once `Unsubscribe` is returned, it is guaranteed that no more messages are sent to the channel.
 func (s *Subscription) Unsubscribe() error {
-	return s.pubSub.unsubscribe(s.topic, s.channel)
+	return s.pubSub.unsubscribe(s)
+}
+
+// codecOf returns a codec that unmarshals messages of the given topic delivered to the subscription.
+func (s *Subscription) codecOf(topic string) types.Codec {
+	if s.codec != nil {
+		return s.codec
+	}
+	return s.pubSub.opts.codecOf(topic)
 }
 
 // subscriptionSet is a set of subscriptions that PubSub should deliver messages to.
-// The key is guaranteed to be channels.
-type subscriptionSet map[interface{}]struct{}
+type subscriptionSet map[*Subscription]struct{}
 
 func newSubscriptionSet() subscriptionSet {
-	return subscriptionSet(map[interface{}]struct{}{})
+	return subscriptionSet(map[*Subscription]struct{}{})
+}
+
+func (set subscriptionSet) Add(sub *Subscription) {
+	set[sub] = struct{}{}
 }
 
-func (set subscriptionSet) Add(ch interface{}) {
-	set[ch] = struct{}{}
+func (set subscriptionSet) Delete(sub *Subscription) {
+	delete(set, sub)
 }
 
-func (set subscriptionSet) Delete(ch interface{}) {
-	delete(set, ch)
+func (set subscriptionSet) Has(sub *Subscription) bool {
+	_, ok := set[sub]
+	return ok
 }
 
 func (set subscriptionSet) Copy() subscriptionSet {
@@ -279,9 +719,9 @@ func (set subscriptionSet) Copy() subscriptionSet {
 	return clone
 }
 
-func (set subscriptionSet) ForEach(fn func(interface{})) {
-	for ch := range set {
-		fn(ch)
+func (set subscriptionSet) ForEach(fn func(*Subscription)) {
+	for sub := range set {
+		fn(sub)
 	}
 }
 
@@ -1,13 +1,52 @@
 package kiara_test
 
 import (
+	"fmt"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+
+	"github.com/genkami/kiara"
+	"github.com/genkami/kiara/adapter/inmemory"
 )
 
 func TestKiara(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Kiara Suite")
 }
+
+// newPubSub returns a PubSub whose adapter is connected to `broker`.
+func newPubSub(broker *inmemory.Broker, opts ...kiara.Option) *kiara.PubSub {
+	return kiara.NewPubSub(inmemory.NewAdapter(broker), opts...)
+}
+
+// subscribe is the same as kiara.Subscribe except that it fails the test instead of returning an error.
+func subscribe[T any](pubsub *kiara.PubSub, topic string, options ...kiara.SubscriptionOption) *kiara.TypedSubscription[T] {
+	sub, err := kiara.Subscribe[T](pubsub, topic, options...)
+	Expect(err).NotTo(HaveOccurred())
+	return sub
+}
+
+// receive waits for a message from `ch` and fails the test if none arrives in time.
+func receive[T any](ch <-chan T) T {
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(timeoutExpectedNotToExceed):
+		Fail("timeout")
+		var zero T
+		return zero
+	}
+}
+
+// expectNoMessage fails the test if a message arrives from `ch` for a while.
+func expectNoMessage[T any](ch <-chan T) {
+	select {
+	case v := <-ch:
+		Fail(fmt.Sprintf("unexpected message arrived: %+v", v))
+	case <-time.After(timeoutExpectedToExceed):
+		// OK
+	}
+}
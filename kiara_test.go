@@ -10,6 +10,7 @@ import (
 
 	"github.com/genkami/kiara"
 	"github.com/genkami/kiara/adapter/inmemory"
+	"github.com/genkami/kiara/types"
 )
 
 const defaultChSize = 10
@@ -252,4 +253,90 @@ var _ = Describe("Kiara", func() {
 			})
 		})
 	})
+
+	Describe("Subscribe with AsPattern", func() {
+		Context("when a topic matches the pattern", func() {
+			It("sends a message to the subscriber", func() {
+				sub, err := kiara.SubscribeDelivery[int](pubsub, "room:*", kiara.AsPattern())
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+				ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+				defer cancel()
+				var sent int = 123
+				err = pubsub.Publish(ctx, "room:123", sent)
+				Expect(err).NotTo(HaveOccurred())
+				select {
+				case received := <-sub.Channel():
+					Expect(received.Topic).To(Equal("room:123"))
+					Expect(received.Value).To(Equal(sent))
+				case <-time.After(timeoutExpectedNotToExceed):
+					Fail("timeout")
+				}
+			})
+		})
+
+		Context("when a topic does not match the pattern", func() {
+			It("does not send any message to the subscriber", func() {
+				ch := make(chan int, defaultChSize)
+				sub, err := pubsub.Subscribe("room:*", ch, kiara.AsPattern())
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+				ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+				defer cancel()
+				err = pubsub.Publish(ctx, "lobby:123", 123)
+				Expect(err).NotTo(HaveOccurred())
+				select {
+				case msg := <-ch:
+					Fail(fmt.Sprintf("expected no message but got %v", msg))
+				case <-time.After(timeoutExpectedToExceed):
+					// OK
+				}
+			})
+		})
+
+		Context("when a topic is subscribed both exactly and by the pattern", func() {
+			It("sends a message to each subscriber exactly once", func() {
+				topic := "room:123"
+				exactCh := make(chan int, defaultChSize)
+				exactSub, err := pubsub.Subscribe(topic, exactCh)
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(exactSub.Unsubscribe()).NotTo(HaveOccurred()) }()
+				patternCh := make(chan int, defaultChSize)
+				patternSub, err := pubsub.Subscribe("room:*", patternCh, kiara.AsPattern())
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(patternSub.Unsubscribe()).NotTo(HaveOccurred()) }()
+
+				ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+				defer cancel()
+				var sent int = 123
+				err = pubsub.Publish(ctx, topic, sent)
+				Expect(err).NotTo(HaveOccurred())
+				for i, ch := range []chan int{exactCh, patternCh} {
+					select {
+					case received := <-ch:
+						Expect(received).To(Equal(sent))
+					case <-time.After(timeoutExpectedNotToExceed):
+						Fail(fmt.Sprintf("%d: timeout", i))
+					}
+					select {
+					case msg := <-ch:
+						Fail(fmt.Sprintf("%d: expected no message but got %v", i, msg))
+					case <-time.After(timeoutExpectedToExceed):
+						// OK
+					}
+				}
+			})
+		})
+
+		Context("when the adapter does not support patterns", func() {
+			It("returns an error", func() {
+				adapter := struct{ types.Adapter }{inmemory.NewAdapter(broker)}
+				pubsub := kiara.NewPubSub(adapter)
+				defer pubsub.Close()
+				ch := make(chan int, defaultChSize)
+				_, err := pubsub.Subscribe("room:*", ch, kiara.AsPattern())
+				Expect(err).To(MatchError(kiara.ErrPatternNotSupported))
+			})
+		})
+	})
 })
@@ -0,0 +1,85 @@
+package prometheus
+
+import (
+	"strings"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/genkami/kiara"
+)
+
+const defaultNamespace = "kiara"
+
+// options is a configuration of Collector.
+type options struct {
+	namespace        string
+	buckets          []float64
+	replyTopicPrefix string
+
+	// topicLabel overrides the default conversion from topics into labels if not nil.
+	topicLabel func(topic string) string
+}
+
+func defaultOptions() options {
+	return options{
+		namespace:        defaultNamespace,
+		buckets:          prom.DefBuckets,
+		replyTopicPrefix: kiara.DefaultReplyTopicPrefix,
+	}
+}
+
+// labelOf converts a topic into the value of the topic label.
+// By default, topics are used as they are except reply topics, which are unique to each request.
+func (opts *options) labelOf(topic string) string {
+	if opts.topicLabel != nil {
+		return opts.topicLabel(topic)
+	}
+	if strings.HasPrefix(topic, opts.replyTopicPrefix) {
+		return opts.replyTopicPrefix + "*"
+	}
+	return topic
+}
+
+// Option configures Collector.
+type Option interface {
+	apply(*options)
+}
+
+type optionFunc func(*options)
+
+func (f optionFunc) apply(opts *options) {
+	f(opts)
+}
+
+// Namespace sets the namespace of metrics. The default is "kiara".
+func Namespace(namespace string) Option {
+	return optionFunc(func(opts *options) {
+		opts.namespace = namespace
+	})
+}
+
+// Buckets sets buckets of latency histograms. The default is prometheus.DefBuckets.
+func Buckets(buckets []float64) Option {
+	return optionFunc(func(opts *options) {
+		opts.buckets = buckets
+	})
+}
+
+// TopicLabel sets a function that converts topics into values of the topic label.
+// Use this to keep the cardinality of metrics low when topics contain IDs, e.g. by converting `room:123` into `room:*`.
+//
+// By default, topics are used as they are, except that reply topics of PubSub.Request are converted into `_kiara.reply.*`
+// (or the prefix given by ReplyTopicPrefix followed by `*`).
+func TopicLabel(fn func(topic string) string) Option {
+	return optionFunc(func(opts *options) {
+		opts.topicLabel = fn
+	})
+}
+
+// ReplyTopicPrefix sets the prefix of reply topics that are converted into the same label by default.
+// Give the same prefix as kiara.ReplyTopicPrefix given to PubSubs. The default is kiara.DefaultReplyTopicPrefix.
+func ReplyTopicPrefix(prefix string) Option {
+	return optionFunc(func(opts *options) {
+		opts.replyTopicPrefix = prefix
+	})
+}
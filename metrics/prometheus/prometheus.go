@@ -0,0 +1,262 @@
+// Package prometheus provides a Prometheus collector that exports metrics of kiara.PubSub.
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	prom "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/genkami/kiara"
+	"github.com/genkami/kiara/types"
+)
+
+var (
+	// This error is returned when a PubSub is watched more than once.
+	ErrAlreadyWatched = errors.New("already watched")
+)
+
+// HeaderPublishedAt is a header that holds the time when the message is published, in nanoseconds since the Unix epoch.
+// It is used to measure delivery latency.
+const HeaderPublishedAt = "Kiara-Published-At"
+
+const (
+	labelTopic   = "topic"
+	labelAdapter = "adapter"
+)
+
+// Collector is a prom.Collector that exports metrics of PubSubs.
+//
+// Counters and gauges are taken from PubSub.Stats() when metrics are collected, and latency histograms are observed
+// by interceptors returned from Collector.Interceptors.
+type Collector struct {
+	opts options
+
+	lock    sync.Mutex
+	watched map[*kiara.PubSub]string // PubSub -> adapter label
+
+	publishDuration *prom.HistogramVec
+	deliveryLatency *prom.HistogramVec
+
+	published           *prom.Desc
+	delivered           *prom.Desc
+	dropped             *prom.Desc
+	unmarshalFailures   *prom.Desc
+	duplicates          *prom.Desc
+	expired             *prom.Desc
+	publishQueueDepth   *prom.Desc
+	deliveredQueueDepth *prom.Desc
+
+	adapterPublished       *prom.Desc
+	adapterPublishFailures *prom.Desc
+	adapterDelivered       *prom.Desc
+	adapterDropped         *prom.Desc
+	adapterDecodeFailures  *prom.Desc
+	adapterExpired         *prom.Desc
+}
+
+var _ prom.Collector = &Collector{}
+
+// NewCollector creates a new Collector.
+func NewCollector(options ...Option) *Collector {
+	opts := defaultOptions()
+	for _, o := range options {
+		o.apply(&opts)
+	}
+	name := func(name string) string {
+		return prom.BuildFQName(opts.namespace, "", name)
+	}
+	topicLabels := []string{labelTopic, labelAdapter}
+	adapterLabels := []string{labelAdapter}
+	return &Collector{
+		opts:    opts,
+		watched: map[*kiara.PubSub]string{},
+		publishDuration: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: opts.namespace,
+			Name:      "publish_duration_seconds",
+			Help:      "Time taken to queue a message to be published, including time waiting for the publish queue to have room.",
+			Buckets:   opts.buckets,
+		}, topicLabels),
+		deliveryLatency: prom.NewHistogramVec(prom.HistogramOpts{
+			Namespace: opts.namespace,
+			Name:      "delivery_latency_seconds",
+			Help:      "Time from when a message is published until it is delivered to a subscription.",
+			Buckets:   opts.buckets,
+		}, topicLabels),
+		published:              prom.NewDesc(name("published_total"), "Number of messages sent to the adapter to be published.", topicLabels, nil),
+		delivered:              prom.NewDesc(name("delivered_total"), "Number of messages delivered to subscriptions.", topicLabels, nil),
+		dropped:                prom.NewDesc(name("dropped_total"), "Number of messages discarded because subscribers were too slow.", topicLabels, nil),
+		unmarshalFailures:      prom.NewDesc(name("unmarshal_failures_total"), "Number of messages that could not be unmarshaled.", topicLabels, nil),
+		duplicates:             prom.NewDesc(name("duplicates_total"), "Number of messages discarded as duplicates.", topicLabels, nil),
+		expired:                prom.NewDesc(name("expired_total"), "Number of messages discarded because they expired before being delivered.", topicLabels, nil),
+		publishQueueDepth:      prom.NewDesc(name("publish_queue_depth"), "Number of messages waiting to be published by the adapter.", adapterLabels, nil),
+		deliveredQueueDepth:    prom.NewDesc(name("delivered_queue_depth"), "Number of messages waiting to be delivered to subscriptions.", adapterLabels, nil),
+		adapterPublished:       prom.NewDesc(name("adapter_published_total"), "Number of messages that the adapter sent to the backend.", adapterLabels, nil),
+		adapterPublishFailures: prom.NewDesc(name("adapter_publish_failures_total"), "Number of messages that the adapter could not send to the backend.", adapterLabels, nil),
+		adapterDelivered:       prom.NewDesc(name("adapter_delivered_total"), "Number of messages that the adapter received from the backend.", adapterLabels, nil),
+		adapterDropped:         prom.NewDesc(name("adapter_dropped_total"), "Number of messages that the adapter discarded.", adapterLabels, nil),
+		adapterDecodeFailures:  prom.NewDesc(name("adapter_decode_failures_total"), "Number of messages from the backend that the adapter could not decode.", adapterLabels, nil),
+		adapterExpired:         prom.NewDesc(name("adapter_expired_total"), "Number of messages that the adapter discarded because they expired.", adapterLabels, nil),
+	}
+}
+
+// Interceptors returns options that make a PubSub observe latency of messages into the Collector.
+// `adapter` is the value of the adapter label, such as "redis" or "nats".
+//
+// The publish interceptor attaches HeaderPublishedAt to every message, and the delivery interceptor observes the time
+// elapsed since then. Note that delivery latency between different hosts is affected by their clock skew.
+func (c *Collector) Interceptors(adapter string) []kiara.Option {
+	return []kiara.Option{
+		kiara.WithPublishInterceptors(func(ctx context.Context, msg *types.Message, next kiara.PublishFunc) error {
+			start := time.Now()
+			msg.SetHeader(HeaderPublishedAt, strconv.FormatInt(start.UnixNano(), 10))
+			err := next(ctx, msg)
+			if err == nil {
+				c.publishDuration.WithLabelValues(c.opts.labelOf(msg.Topic), adapter).Observe(time.Since(start).Seconds())
+			}
+			return err
+		}),
+		kiara.WithDeliveryInterceptors(func(ctx context.Context, sub *kiara.Subscription, msg *types.Message, next kiara.DeliverFunc) error {
+			err := next(ctx, msg)
+			if err != nil {
+				return err
+			}
+			publishedAt, parseErr := strconv.ParseInt(msg.Headers[HeaderPublishedAt], 10, 64)
+			if parseErr != nil {
+				// The message is published by a PubSub that is not instrumented.
+				return nil
+			}
+			latency := time.Since(time.Unix(0, publishedAt))
+			c.deliveryLatency.WithLabelValues(c.opts.labelOf(msg.Topic), adapter).Observe(latency.Seconds())
+			return nil
+		}),
+	}
+}
+
+// Watch makes the Collector export counters and gauges of the given PubSub with the given adapter label.
+// More than one PubSub may be watched with the same adapter label, in which case their statistics are summed up.
+func (c *Collector) Watch(pubsub *kiara.PubSub, adapter string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if _, ok := c.watched[pubsub]; ok {
+		return ErrAlreadyWatched
+	}
+	c.watched[pubsub] = adapter
+	return nil
+}
+
+// Unwatch stops exporting counters and gauges of the given PubSub.
+func (c *Collector) Unwatch(pubsub *kiara.PubSub) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.watched, pubsub)
+}
+
+// Describe implements prom.Collector.
+func (c *Collector) Describe(ch chan<- *prom.Desc) {
+	c.publishDuration.Describe(ch)
+	c.deliveryLatency.Describe(ch)
+	ch <- c.published
+	ch <- c.delivered
+	ch <- c.dropped
+	ch <- c.unmarshalFailures
+	ch <- c.duplicates
+	ch <- c.expired
+	ch <- c.publishQueueDepth
+	ch <- c.deliveredQueueDepth
+	ch <- c.adapterPublished
+	ch <- c.adapterPublishFailures
+	ch <- c.adapterDelivered
+	ch <- c.adapterDropped
+	ch <- c.adapterDecodeFailures
+	ch <- c.adapterExpired
+}
+
+// Collect implements prom.Collector.
+func (c *Collector) Collect(ch chan<- prom.Metric) {
+	c.publishDuration.Collect(ch)
+	c.deliveryLatency.Collect(ch)
+
+	c.lock.Lock()
+	watched := make(map[*kiara.PubSub]string, len(c.watched))
+	for pubsub, adapter := range c.watched {
+		watched[pubsub] = adapter
+	}
+	c.lock.Unlock()
+
+	// Several PubSubs may share the same adapter label and several topics may share the same topic label,
+	// so their statistics must be summed up before being exported.
+	byAdapter := map[string]*labeledStats{}
+	for pubsub, adapter := range watched {
+		sum, ok := byAdapter[adapter]
+		if !ok {
+			sum = &labeledStats{topics: map[string]kiara.TopicStats{}}
+			byAdapter[adapter] = sum
+		}
+		sum.add(&c.opts, pubsub.Stats())
+	}
+	for adapter, sum := range byAdapter {
+		c.collectStats(ch, adapter, sum)
+	}
+}
+
+// labeledStats is the sum of kiara.Stats of PubSubs that share the same adapter label.
+type labeledStats struct {
+	topics              map[string]kiara.TopicStats // topic label -> stats
+	publishQueueDepth   int
+	deliveredQueueDepth int
+	adapter             *types.AdapterStats // nil unless any of the adapters implements types.StatsAdapter
+}
+
+func (s *labeledStats) add(opts *options, stats kiara.Stats) {
+	for topic, t := range stats.Topics {
+		label := opts.labelOf(topic)
+		sum := s.topics[label]
+		sum.Published += t.Published
+		sum.Delivered += t.Delivered
+		sum.Dropped += t.Dropped
+		sum.UnmarshalFailures += t.UnmarshalFailures
+		sum.Duplicates += t.Duplicates
+		sum.Expired += t.Expired
+		s.topics[label] = sum
+	}
+	s.publishQueueDepth += stats.PublishQueueDepth
+	s.deliveredQueueDepth += stats.DeliveredQueueDepth
+	if stats.Adapter == nil {
+		return
+	}
+	if s.adapter == nil {
+		s.adapter = &types.AdapterStats{}
+	}
+	s.adapter.Published += stats.Adapter.Published
+	s.adapter.PublishFailures += stats.Adapter.PublishFailures
+	s.adapter.Delivered += stats.Adapter.Delivered
+	s.adapter.Dropped += stats.Adapter.Dropped
+	s.adapter.DecodeFailures += stats.Adapter.DecodeFailures
+	s.adapter.Expired += stats.Adapter.Expired
+}
+
+func (c *Collector) collectStats(ch chan<- prom.Metric, adapter string, stats *labeledStats) {
+	for label, s := range stats.topics {
+		ch <- prom.MustNewConstMetric(c.published, prom.CounterValue, float64(s.Published), label, adapter)
+		ch <- prom.MustNewConstMetric(c.delivered, prom.CounterValue, float64(s.Delivered), label, adapter)
+		ch <- prom.MustNewConstMetric(c.dropped, prom.CounterValue, float64(s.Dropped), label, adapter)
+		ch <- prom.MustNewConstMetric(c.unmarshalFailures, prom.CounterValue, float64(s.UnmarshalFailures), label, adapter)
+		ch <- prom.MustNewConstMetric(c.duplicates, prom.CounterValue, float64(s.Duplicates), label, adapter)
+		ch <- prom.MustNewConstMetric(c.expired, prom.CounterValue, float64(s.Expired), label, adapter)
+	}
+	ch <- prom.MustNewConstMetric(c.publishQueueDepth, prom.GaugeValue, float64(stats.publishQueueDepth), adapter)
+	ch <- prom.MustNewConstMetric(c.deliveredQueueDepth, prom.GaugeValue, float64(stats.deliveredQueueDepth), adapter)
+	if stats.adapter == nil {
+		return
+	}
+	ch <- prom.MustNewConstMetric(c.adapterPublished, prom.CounterValue, float64(stats.adapter.Published), adapter)
+	ch <- prom.MustNewConstMetric(c.adapterPublishFailures, prom.CounterValue, float64(stats.adapter.PublishFailures), adapter)
+	ch <- prom.MustNewConstMetric(c.adapterDelivered, prom.CounterValue, float64(stats.adapter.Delivered), adapter)
+	ch <- prom.MustNewConstMetric(c.adapterDropped, prom.CounterValue, float64(stats.adapter.Dropped), adapter)
+	ch <- prom.MustNewConstMetric(c.adapterDecodeFailures, prom.CounterValue, float64(stats.adapter.DecodeFailures), adapter)
+	ch <- prom.MustNewConstMetric(c.adapterExpired, prom.CounterValue, float64(stats.adapter.Expired), adapter)
+}
@@ -0,0 +1,197 @@
+package prometheus_test
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/genkami/kiara"
+	"github.com/genkami/kiara/adapter/inmemory"
+	"github.com/genkami/kiara/metrics/prometheus"
+)
+
+const timeoutExpectedNotToExceed = 3 * time.Second
+
+var _ = Describe("Collector", func() {
+	var (
+		broker    *inmemory.Broker
+		collector *prometheus.Collector
+		pubsub    *kiara.PubSub
+	)
+
+	BeforeEach(func() {
+		broker = inmemory.NewBroker()
+		collector = prometheus.NewCollector()
+		pubsub = kiara.NewPubSub(inmemory.NewAdapter(broker), collector.Interceptors("inmemory")...)
+		Expect(collector.Watch(pubsub, "inmemory")).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		pubsub.Close()
+		broker.Close()
+	})
+
+	publishAndReceive := func(topic string, n int) {
+		sub, err := kiara.Subscribe[int](pubsub, topic)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+		ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+		defer cancel()
+		for i := 0; i < n; i++ {
+			Expect(pubsub.Publish(ctx, topic, i)).NotTo(HaveOccurred())
+		}
+		for i := 0; i < n; i++ {
+			select {
+			case <-sub.Channel():
+			case <-time.After(timeoutExpectedNotToExceed):
+				Fail("timeout")
+			}
+		}
+	}
+
+	It("can be registered to a registry", func() {
+		registry := prom.NewPedanticRegistry()
+		Expect(registry.Register(collector)).NotTo(HaveOccurred())
+		publishAndReceive("room:123", 1)
+		_, err := registry.Gather()
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("exports counters of messages", func() {
+		publishAndReceive("room:123", 3)
+
+		expected := `
+# HELP kiara_delivered_total Number of messages delivered to subscriptions.
+# TYPE kiara_delivered_total counter
+kiara_delivered_total{adapter="inmemory",topic="room:123"} 3
+# HELP kiara_published_total Number of messages sent to the adapter to be published.
+# TYPE kiara_published_total counter
+kiara_published_total{adapter="inmemory",topic="room:123"} 3
+`
+		// Messages are counted as delivered right after they are sent to subscribers.
+		Eventually(func() error {
+			return testutil.CollectAndCompare(collector, strings.NewReader(expected), "kiara_published_total", "kiara_delivered_total")
+		}, timeoutExpectedNotToExceed).Should(Succeed())
+
+		expected = `
+# HELP kiara_adapter_published_total Number of messages that the adapter sent to the backend.
+# TYPE kiara_adapter_published_total counter
+kiara_adapter_published_total{adapter="inmemory"} 3
+# HELP kiara_publish_queue_depth Number of messages waiting to be published by the adapter.
+# TYPE kiara_publish_queue_depth gauge
+kiara_publish_queue_depth{adapter="inmemory"} 0
+`
+		err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "kiara_adapter_published_total", "kiara_publish_queue_depth")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("observes latency of messages", func() {
+		publishAndReceive("room:123", 3)
+		Expect(testutil.CollectAndCount(collector, "kiara_publish_duration_seconds")).To(Equal(1))
+		Eventually(func() int {
+			return testutil.CollectAndCount(collector, "kiara_delivery_latency_seconds")
+		}, timeoutExpectedNotToExceed).Should(Equal(1))
+	})
+
+	It("uses the same topic label for all reply topics", func() {
+		topic := "rpc:echo"
+		sub, err := kiara.Respond(pubsub, topic, func(_ context.Context, req string) (string, error) {
+			return req, nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+		ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+		defer cancel()
+		for i := 0; i < 3; i++ {
+			var resp string
+			Expect(pubsub.Request(ctx, topic, "kikkeriki", &resp)).NotTo(HaveOccurred())
+		}
+		// Each request has its own reply topic, but they must not increase the cardinality.
+		Expect(testutil.CollectAndCount(collector, "kiara_publish_duration_seconds")).To(Equal(2))
+	})
+
+	Context("when ReplyTopicPrefix is given", func() {
+		It("uses the same topic label for all reply topics with the prefix", func() {
+			pubsub.Close()
+			collector = prometheus.NewCollector(prometheus.ReplyTopicPrefix("rpc.reply."))
+			opts := append(collector.Interceptors("inmemory"), kiara.ReplyTopicPrefix("rpc.reply."))
+			pubsub = kiara.NewPubSub(inmemory.NewAdapter(broker), opts...)
+			topic := "rpc:echo"
+			sub, err := kiara.Respond(pubsub, topic, func(_ context.Context, req string) (string, error) {
+				return req, nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			for i := 0; i < 3; i++ {
+				var resp string
+				Expect(pubsub.Request(ctx, topic, "kikkeriki", &resp)).NotTo(HaveOccurred())
+			}
+			Expect(testutil.CollectAndCount(collector, "kiara_publish_duration_seconds")).To(Equal(2))
+		})
+	})
+
+	Context("when TopicLabel is given", func() {
+		It("converts topics into labels", func() {
+			collector = prometheus.NewCollector(prometheus.TopicLabel(func(topic string) string {
+				return strings.SplitN(topic, ":", 2)[0] + ":*"
+			}))
+			Expect(collector.Watch(pubsub, "inmemory")).NotTo(HaveOccurred())
+			publishAndReceive("room:123", 1)
+			publishAndReceive("room:456", 2)
+
+			expected := `
+# HELP kiara_published_total Number of messages sent to the adapter to be published.
+# TYPE kiara_published_total counter
+kiara_published_total{adapter="inmemory",topic="room:*"} 3
+`
+			err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "kiara_published_total")
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("when the same PubSub is watched twice", func() {
+		It("returns an error", func() {
+			err := collector.Watch(pubsub, "redis")
+			Expect(err).To(MatchError(prometheus.ErrAlreadyWatched))
+		})
+	})
+
+	Context("when PubSubs share the same adapter label", func() {
+		It("sums up their counters", func() {
+			another := kiara.NewPubSub(inmemory.NewAdapter(broker))
+			defer another.Close()
+			Expect(collector.Watch(another, "inmemory")).NotTo(HaveOccurred())
+			publishAndReceive("room:123", 1)
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			Expect(another.PublishSync(ctx, "room:123", 1)).NotTo(HaveOccurred())
+			Expect(another.PublishSync(ctx, "room:123", 2)).NotTo(HaveOccurred())
+
+			expected := `
+# HELP kiara_published_total Number of messages sent to the adapter to be published.
+# TYPE kiara_published_total counter
+kiara_published_total{adapter="inmemory",topic="room:123"} 3
+# HELP kiara_adapter_published_total Number of messages that the adapter sent to the backend.
+# TYPE kiara_adapter_published_total counter
+kiara_adapter_published_total{adapter="inmemory"} 3
+`
+			err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "kiara_published_total", "kiara_adapter_published_total")
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	Context("when the PubSub is unwatched", func() {
+		It("stops exporting its counters", func() {
+			publishAndReceive("room:123", 1)
+			collector.Unwatch(pubsub)
+			Expect(testutil.CollectAndCount(collector, "kiara_published_total")).To(BeZero())
+		})
+	})
+})
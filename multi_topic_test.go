@@ -0,0 +1,127 @@
+package kiara_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/genkami/kiara"
+	"github.com/genkami/kiara/adapter/inmemory"
+)
+
+var _ = Describe("Multi-topic subscriptions", func() {
+	var (
+		broker *inmemory.Broker
+		pubsub *kiara.PubSub
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		broker = inmemory.NewBroker()
+		pubsub = newPubSub(broker)
+		ctx, cancel = context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+	})
+
+	AfterEach(func() {
+		cancel()
+		pubsub.Close()
+		broker.Close()
+	})
+
+	Describe("PubSub.SubscribeTopics", func() {
+		It("sends messages of all the topics to the channel", func() {
+			ch := make(chan kiara.Delivery[int], 2)
+			sub, err := pubsub.SubscribeTopics([]string{"room:123", "lobby"}, ch)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			before := time.Now()
+			Expect(pubsub.Publish(ctx, "room:123", 1)).To(Succeed())
+			d := receive(ch)
+			Expect(d.Topic).To(Equal("room:123"))
+			Expect(d.Value).To(Equal(1))
+			Expect(d.Context).NotTo(BeNil())
+			Expect(d.ReceivedAt).To(BeTemporally(">=", before))
+			Expect(pubsub.Publish(ctx, "lobby", 2)).To(Succeed())
+			d = receive(ch)
+			Expect(d.Topic).To(Equal("lobby"))
+			Expect(d.Value).To(Equal(2))
+		})
+
+		It("stops receiving messages of all the topics once unsubscribed", func() {
+			ch := make(chan kiara.Delivery[int], 2)
+			sub, err := pubsub.SubscribeTopics([]string{"room:123", "lobby"}, ch)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sub.Unsubscribe()).To(Succeed())
+			Expect(pubsub.Publish(ctx, "room:123", 1)).To(Succeed())
+			Expect(pubsub.Publish(ctx, "lobby", 2)).To(Succeed())
+			expectNoMessage(ch)
+		})
+
+		It("keeps other subscriptions to the same topics", func() {
+			multi := make(chan kiara.Delivery[int], 2)
+			sub, err := pubsub.SubscribeTopics([]string{"room:123", "lobby"}, multi)
+			Expect(err).NotTo(HaveOccurred())
+			single := make(chan kiara.Delivery[int], 2)
+			other, err := pubsub.Subscribe("lobby", single)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(other.Unsubscribe()).NotTo(HaveOccurred()) }()
+			Expect(sub.Unsubscribe()).To(Succeed())
+			Expect(pubsub.Publish(ctx, "lobby", 1)).To(Succeed())
+			Expect(receive(single).Value).To(Equal(1))
+		})
+
+		It("subscribes to duplicated topics only once", func() {
+			ch := make(chan kiara.Delivery[int], 2)
+			sub, err := pubsub.SubscribeTopics([]string{"lobby", "lobby"}, ch)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			Expect(pubsub.Publish(ctx, "lobby", 1)).To(Succeed())
+			Expect(receive(ch).Value).To(Equal(1))
+			expectNoMessage(ch)
+		})
+
+		Context("when no topics are given", func() {
+			It("returns ErrNoTopics", func() {
+				_, err := pubsub.SubscribeTopics(nil, make(chan int))
+				Expect(err).To(MatchError(kiara.ErrNoTopics))
+			})
+		})
+	})
+
+	Describe("SubscribeTopics", func() {
+		It("sends messages of all the topics to the channel", func() {
+			sub, err := kiara.SubscribeTopics[kiara.Delivery[int]](pubsub, []string{"room:123", "lobby"})
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			Expect(pubsub.Publish(ctx, "lobby", 1)).To(Succeed())
+			Expect(pubsub.Publish(ctx, "room:123", 2)).To(Succeed())
+			topics := map[string]int{}
+			for i := 0; i < 2; i++ {
+				d := receive(sub.Channel())
+				topics[d.Topic] = d.Value
+			}
+			Expect(topics).To(Equal(map[string]int{"lobby": 1, "room:123": 2}))
+		})
+	})
+
+	Describe("SubscribeFunc", func() {
+		Context("when T is Delivery", func() {
+			It("passes the metadata to the handler", func() {
+				ch := make(chan kiara.Delivery[int], 1)
+				sub, err := kiara.SubscribeFunc(pubsub, "lobby", func(_ context.Context, d kiara.Delivery[int]) error {
+					ch <- d
+					return nil
+				})
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+				Expect(pubsub.Publish(ctx, "lobby", 1)).To(Succeed())
+				d := receive(ch)
+				Expect(d.Topic).To(Equal("lobby"))
+				Expect(d.Value).To(Equal(1))
+			})
+		})
+	})
+})
@@ -1,7 +1,11 @@
 package kiara
 
 import (
+	"strconv"
+	"time"
+
 	"github.com/genkami/kiara/codec/gob"
+	"github.com/genkami/kiara/internal/glob"
 	"github.com/genkami/kiara/types"
 )
 
@@ -9,25 +13,72 @@ const (
 	defaultPublishChannelSize   = 100
 	defaultDeliveredChannelSize = 100
 	defaultErrorChannelSize     = 100
+	defaultSchedulePollInterval = time.Second
+
+	defaultSubscriptionChannelSize = 100
+	defaultHandlerWorkers          = 1
 )
 
+// DefaultReplyTopicPrefix is the prefix of reply topics that PubSub.Request uses unless ReplyTopicPrefix is given.
+const DefaultReplyTopicPrefix = "_kiara.reply."
+
 // options is a configuration of PubSub.
 type options struct {
-	publishChSize   int
-	deliveredChSize int
-	errorChSize     int
-	codec           types.Codec
+	publishChSize    int
+	deliveredChSize  int
+	errorChSize      int
+	codec            types.Codec
+	replyTopicPrefix string
+
+	// topicCodecs and patternCodecs override `codec` for certain topics.
+	topicCodecs   map[string]types.Codec
+	patternCodecs []patternCodec
+
+	publishInterceptors  []PublishInterceptor
+	deliveryInterceptors []DeliveryInterceptor
+
+	assignIDs   bool
+	dedupWindow time.Duration
+	dedupSize   int
+
+	scheduleStore        types.ScheduleStore
+	schedulePollInterval time.Duration
 }
 
 func defaultOptions() options {
 	return options{
-		publishChSize:   defaultPublishChannelSize,
-		deliveredChSize: defaultDeliveredChannelSize,
-		errorChSize:     defaultErrorChannelSize,
-		codec:           gob.Codec,
+		publishChSize:    defaultPublishChannelSize,
+		deliveredChSize:  defaultDeliveredChannelSize,
+		errorChSize:      defaultErrorChannelSize,
+		codec:            gob.Codec,
+		replyTopicPrefix: DefaultReplyTopicPrefix,
+
+		scheduleStore:        NewMemoryScheduleStore(),
+		schedulePollInterval: defaultSchedulePollInterval,
 	}
 }
 
+// patternCodec is a codec registered for topics that match the pattern.
+type patternCodec struct {
+	pattern string
+	codec   types.Codec
+}
+
+// codecOf returns a codec that marshals and unmarshals messages of the given topic.
+// A codec registered for the exact topic takes precedence over ones registered for patterns, which are tried in
+// the order they are registered, and the default codec is used if none of them match.
+func (o *options) codecOf(topic string) types.Codec {
+	if codec, ok := o.topicCodecs[topic]; ok {
+		return codec
+	}
+	for _, pc := range o.patternCodecs {
+		if glob.Match(pc.pattern, topic) {
+			return pc.codec
+		}
+	}
+	return o.codec
+}
+
 // Option configures PubSub.
 type Option interface {
 	apply(*options)
@@ -42,12 +93,37 @@ func (f optionFunc) apply(opts *options) {
 // WithCodec specifies a codec that PubSub uses to marshal and unmarshal messages.
 //
 // By default, messages are marshaled into gob format.
+// Use WithTopicCodec and WithPatternCodec to use different codecs for certain topics.
 func WithCodec(codec types.Codec) Option {
 	return optionFunc(func(opts *options) {
 		opts.codec = codec
 	})
 }
 
+// WithTopicCodec specifies a codec that PubSub uses to marshal and unmarshal messages of the given topic
+// instead of the one given by WithCodec.
+func WithTopicCodec(topic string, codec types.Codec) Option {
+	return optionFunc(func(opts *options) {
+		if opts.topicCodecs == nil {
+			opts.topicCodecs = map[string]types.Codec{}
+		}
+		opts.topicCodecs[topic] = codec
+	})
+}
+
+// WithPatternCodec specifies a codec that PubSub uses to marshal and unmarshal messages of topics that match
+// the given pattern instead of the one given by WithCodec.
+//
+// Patterns are glob-style regardless of the adapter: `*` matches any sequence of characters, `?` matches any single
+// character, `[abc]`, `[^abc]` and `[a-z]` match a character in (or not in) a set, and `\` escapes the succeeding character.
+// A codec given by WithTopicCodec takes precedence over this, and if more than one pattern matches a topic,
+// the one given first is used.
+func WithPatternCodec(pattern string, codec types.Codec) Option {
+	return optionFunc(func(opts *options) {
+		opts.patternCodecs = append(opts.patternCodecs, patternCodec{pattern: pattern, codec: codec})
+	})
+}
+
 // PublishChannelSize sets the size of a channel that contains messages that will be sent later.
 func PublishChannelSize(size int) Option {
 	return optionFunc(func(opts *options) {
@@ -68,3 +144,235 @@ func ErrorChannelSize(size int) Option {
 		opts.errorChSize = size
 	})
 }
+
+// ReplyTopicPrefix sets a prefix of reply topics that PubSub.Request subscribes to in order to receive replies.
+// It is not used when the adapter supports request/reply natively.
+func ReplyTopicPrefix(prefix string) Option {
+	return optionFunc(func(opts *options) {
+		opts.replyTopicPrefix = prefix
+	})
+}
+
+// WithPublishInterceptors adds interceptors that are applied to every message that the PubSub publishes.
+// Interceptors are called in the order they are given, and the first one sees the message first.
+// When given more than once, interceptors are appended to the ones given before.
+func WithPublishInterceptors(interceptors ...PublishInterceptor) Option {
+	return optionFunc(func(opts *options) {
+		opts.publishInterceptors = append(opts.publishInterceptors, interceptors...)
+	})
+}
+
+// WithDeliveryInterceptors adds interceptors that are applied to every message that the PubSub delivers to subscriptions.
+// Interceptors are called in the order they are given, and the first one sees the message first.
+// When given more than once, interceptors are appended to the ones given before.
+func WithDeliveryInterceptors(interceptors ...DeliveryInterceptor) Option {
+	return optionFunc(func(opts *options) {
+		opts.deliveryInterceptors = append(opts.deliveryInterceptors, interceptors...)
+	})
+}
+
+// WithMessageIDs makes PubSub give a unique ID (see types.HeaderMessageID) to every message that it publishes
+// unless the publisher gives its own ID by WithMessageID.
+//
+// Note that every message then has headers, so it can only be read by subscribers that support headers.
+// For example, messages sent through the Redis adapter are framed, and the NATS adapter requires NATS Server 2.2 or later.
+// IDs are not assigned by default.
+func WithMessageIDs() Option {
+	return optionFunc(func(opts *options) {
+		opts.assignIDs = true
+	})
+}
+
+// WithDeduplication makes PubSub discard messages whose IDs (see types.HeaderMessageID) have already arrived
+// within `window`, before they are delivered to subscriptions.
+// At most `size` IDs are remembered, so duplicates that arrive after `size` other messages are not detected.
+// Messages without IDs are always delivered, so publishers should give them by WithMessageIDs or WithMessageID.
+//
+// Deduplication is disabled by default.
+func WithDeduplication(window time.Duration, size int) Option {
+	return optionFunc(func(opts *options) {
+		opts.dedupWindow = window
+		opts.dedupSize = size
+	})
+}
+
+// WithScheduleStore sets the store of messages scheduled by PublishAt and PublishAfter.
+// Use a durable store such as redis.ScheduleStore so that scheduled messages survive restarts.
+// Note that even a durable store keeps messages only until they are due. Each message is removed from the store before
+// it is published, so it is lost if the process exits or the adapter fails to publish it after then (see types.ScheduleStore).
+// The default is a store that keeps messages in memory.
+func WithScheduleStore(store types.ScheduleStore) Option {
+	return optionFunc(func(opts *options) {
+		opts.scheduleStore = store
+	})
+}
+
+// SchedulePollInterval sets the interval of checking the schedule store for messages scheduled by other PubSubs sharing the store.
+// Messages scheduled by the PubSub itself are published on time regardless of the interval. The default is 1 second.
+func SchedulePollInterval(interval time.Duration) Option {
+	return optionFunc(func(opts *options) {
+		opts.schedulePollInterval = interval
+	})
+}
+
+// subscriptionOptions is a configuration of a subscription.
+type subscriptionOptions struct {
+	channelSize   int
+	pattern       bool
+	workers       int
+	preserveOrder bool
+	backpressure  backpressure
+	codec         types.Codec
+}
+
+func defaultSubscriptionOptions() subscriptionOptions {
+	return subscriptionOptions{
+		channelSize: defaultSubscriptionChannelSize,
+		workers:     defaultHandlerWorkers,
+	}
+}
+
+// SubscriptionOption configures a subscription.
+type SubscriptionOption interface {
+	applySubscription(*subscriptionOptions)
+}
+
+type subscriptionOptionFunc func(*subscriptionOptions)
+
+func (f subscriptionOptionFunc) applySubscription(opts *subscriptionOptions) {
+	f(opts)
+}
+
+// SubscriptionChannelSize sets the size of a channel through which messages are delivered to a TypedSubscription.
+func SubscriptionChannelSize(size int) SubscriptionOption {
+	return subscriptionOptionFunc(func(opts *subscriptionOptions) {
+		opts.channelSize = size
+	})
+}
+
+// AsPattern makes the subscription treat its topic as a pattern, so that it receives messages of every topic that matches the pattern.
+//
+// The syntax of patterns is dependent on the underlying adapter (e.g. `room:*` for Redis, or `room.*` and `room.>` for NATS).
+// Subscribing to a pattern fails with ErrPatternNotSupported if the adapter does not implement types.PatternAdapter.
+func AsPattern() SubscriptionOption {
+	return subscriptionOptionFunc(func(opts *subscriptionOptions) {
+		opts.pattern = true
+	})
+}
+
+// SubscriptionCodec specifies a codec that unmarshals messages delivered to the subscription
+// instead of the one that the PubSub uses for their topics.
+func SubscriptionCodec(codec types.Codec) SubscriptionOption {
+	return subscriptionOptionFunc(func(opts *subscriptionOptions) {
+		opts.codec = codec
+	})
+}
+
+// Workers sets the number of goroutines that run a handler registered by SubscribeFunc.
+// Messages are handled concurrently, and therefore may be handled out of order, when it is greater than 1.
+// Use PreserveTopicOrder to keep the order of messages of the same topic.
+func Workers(n int) SubscriptionOption {
+	return subscriptionOptionFunc(func(opts *subscriptionOptions) {
+		opts.workers = n
+	})
+}
+
+// PreserveTopicOrder makes SubscribeFunc handle messages of the same topic one by one in the order they arrive,
+// by assigning every topic to a single worker. Messages of different topics are still handled concurrently.
+//
+// Note that the queue size given by SubscriptionChannelSize is applied to each worker when this option is set.
+func PreserveTopicOrder() SubscriptionOption {
+	return subscriptionOptionFunc(func(opts *subscriptionOptions) {
+		opts.preserveOrder = true
+	})
+}
+
+// DropNewest makes the subscription discard messages that arrive while its channel is full.
+// ErrSlowConsumer is reported through PubSub.Errors() for each of them. This is the default policy.
+func DropNewest() SubscriptionOption {
+	return subscriptionOptionFunc(func(opts *subscriptionOptions) {
+		opts.backpressure = backpressure{policy: policyDropNewest}
+	})
+}
+
+// DropOldest makes the subscription keep the latest messages that arrive while its channel is full in a ring buffer
+// whose size is the same as the capacity of the channel (or 1 if the channel is unbuffered), and discard the oldest one when the buffer overflows.
+// The channel is the one given to PubSub.Subscribe, or one made with the size given by SubscriptionChannelSize.
+// ErrSlowConsumer is reported through PubSub.Errors() for each message discarded.
+func DropOldest() SubscriptionOption {
+	return subscriptionOptionFunc(func(opts *subscriptionOptions) {
+		opts.backpressure = backpressure{policy: policyDropOldest}
+	})
+}
+
+// BlockWithTimeout makes the subscription wait up to `timeout` after each message arrives for its channel to have room for it,
+// as if the publisher blocked. A message is discarded and ErrSlowConsumer is reported through PubSub.Errors() when it times out.
+// Messages are queued in order while waiting, and waiting never stalls delivery to other subscriptions.
+func BlockWithTimeout(timeout time.Duration) SubscriptionOption {
+	return subscriptionOptionFunc(func(opts *subscriptionOptions) {
+		opts.backpressure = backpressure{policy: policyBlock, timeout: timeout}
+	})
+}
+
+// UnboundedQueue makes the subscription queue all messages that arrive while its channel is full without discarding any of them.
+// Note that the queue grows without limit as long as the subscriber is slower than publishers.
+func UnboundedQueue() SubscriptionOption {
+	return subscriptionOptionFunc(func(opts *subscriptionOptions) {
+		opts.backpressure = backpressure{policy: policyUnbounded}
+	})
+}
+
+// publishOptions is a configuration of a single Publish call.
+type publishOptions struct {
+	headers map[string]string
+}
+
+func defaultPublishOptions() publishOptions {
+	return publishOptions{}
+}
+
+// PublishOption configures a single Publish call.
+type PublishOption interface {
+	applyPublish(*publishOptions)
+}
+
+type publishOptionFunc func(*publishOptions)
+
+func (f publishOptionFunc) applyPublish(opts *publishOptions) {
+	f(opts)
+}
+
+// WithHeaders attaches headers to the message.
+// Headers are sent to subscribers as they are and can be received through Delivery.
+// When given more than once, headers are merged and the latter takes precedence.
+func WithHeaders(headers map[string]string) PublishOption {
+	return publishOptionFunc(func(opts *publishOptions) {
+		if len(headers) == 0 {
+			return
+		}
+		if opts.headers == nil {
+			opts.headers = make(map[string]string, len(headers))
+		}
+		for k, v := range headers {
+			opts.headers[k] = v
+		}
+	})
+}
+
+// WithMessageID sets the ID of the message instead of the one generated by PubSub.
+// Give the same ID when retrying to publish the same event so that subscribers can detect duplicates.
+func WithMessageID(id string) PublishOption {
+	return WithHeaders(map[string]string{types.HeaderMessageID: id})
+}
+
+// WithTTL makes the message expire after `ttl` since it is published.
+// Expired messages are discarded by the adapter and PubSub instead of being delivered, and are counted as Expired in Stats().
+// This is useful for messages that are meaningless once they are stale, such as presence notifications.
+//
+// PublishSync returns ErrExpired if the message expires before the adapter publishes it.
+func WithTTL(ttl time.Duration) PublishOption {
+	return publishOptionFunc(func(opts *publishOptions) {
+		expiresAt := time.Now().Add(ttl).UnixNano()
+		WithHeaders(map[string]string{types.HeaderExpiresAt: strconv.FormatInt(expiresAt, 10)}).applyPublish(opts)
+	})
+}
@@ -1,12 +1,16 @@
 package kiara
 
 import (
+	"time"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
 	"github.com/genkami/kiara/adapter/inmemory"
 	"github.com/genkami/kiara/codec/gob"
+	json "github.com/genkami/kiara/codec/json"
 	"github.com/genkami/kiara/codec/msgpack"
+	"github.com/genkami/kiara/types"
 )
 
 type account struct {
@@ -60,6 +64,27 @@ var _ = Describe("Options", func() {
 		})
 	})
 
+	Describe("WithTopicCodec and WithPatternCodec", func() {
+		It("use the codec of the exact topic, the first matched pattern, and the default in this order", func() {
+			pubsub := newPubSub(
+				WithCodec(msgpack.Codec),
+				WithPatternCodec("json:*", json.Codec),
+				WithPatternCodec("*", gob.Codec),
+				WithTopicCodec("json:msgpack", msgpack.Codec),
+			)
+			Expect(pubsub.opts.codecOf("json:123")).To(Equal(json.Codec))
+			Expect(pubsub.opts.codecOf("json:msgpack")).To(Equal(msgpack.Codec))
+			Expect(pubsub.opts.codecOf("room:123")).To(Equal(gob.Codec))
+		})
+
+		Context("when no codecs are registered for the topic", func() {
+			It("uses the default codec", func() {
+				pubsub := newPubSub(WithCodec(msgpack.Codec), WithTopicCodec("json:123", json.Codec))
+				Expect(pubsub.opts.codecOf("room:123")).To(Equal(msgpack.Codec))
+			})
+		})
+	})
+
 	Describe("PublishChannelSize", func() {
 		Context("when the option is not set", func() {
 			It("uses the default size", func() {
@@ -110,4 +135,196 @@ var _ = Describe("Options", func() {
 			})
 		})
 	})
+
+	Describe("ReplyTopicPrefix", func() {
+		Context("when the option is not set", func() {
+			It("uses the default prefix", func() {
+				pubsub := newPubSub()
+				Expect(pubsub.opts.replyTopicPrefix).To(Equal(DefaultReplyTopicPrefix))
+			})
+		})
+
+		Context("when the option is set", func() {
+			It("uses the given prefix", func() {
+				prefix := "kfp.reply."
+				pubsub := newPubSub(ReplyTopicPrefix(prefix))
+				Expect(pubsub.opts.replyTopicPrefix).To(Equal(prefix))
+			})
+		})
+	})
+})
+
+var _ = Describe("SubscriptionOptions", func() {
+	Describe("SubscriptionChannelSize", func() {
+		Context("when the option is not set", func() {
+			It("uses the default size", func() {
+				opts := defaultSubscriptionOptions()
+				Expect(opts.channelSize).To(Equal(defaultSubscriptionChannelSize))
+			})
+		})
+
+		Context("when the option is set", func() {
+			It("uses the given size", func() {
+				size := 445
+				opts := defaultSubscriptionOptions()
+				SubscriptionChannelSize(size).applySubscription(&opts)
+				Expect(opts.channelSize).To(Equal(size))
+			})
+		})
+	})
+
+	Describe("Workers", func() {
+		Context("when the option is not set", func() {
+			It("uses the default number of workers", func() {
+				opts := defaultSubscriptionOptions()
+				Expect(opts.workers).To(Equal(defaultHandlerWorkers))
+			})
+		})
+
+		Context("when the option is set", func() {
+			It("uses the given number of workers", func() {
+				n := 8
+				opts := defaultSubscriptionOptions()
+				Workers(n).applySubscription(&opts)
+				Expect(opts.workers).To(Equal(n))
+			})
+		})
+	})
+
+	Describe("PreserveTopicOrder", func() {
+		Context("when the option is not set", func() {
+			It("does not preserve the order", func() {
+				opts := defaultSubscriptionOptions()
+				Expect(opts.preserveOrder).To(BeFalse())
+			})
+		})
+
+		Context("when the option is set", func() {
+			It("preserves the order", func() {
+				opts := defaultSubscriptionOptions()
+				PreserveTopicOrder().applySubscription(&opts)
+				Expect(opts.preserveOrder).To(BeTrue())
+			})
+		})
+	})
+
+	Describe("backpressure policies", func() {
+		Context("when no policy is set", func() {
+			It("drops the newest messages", func() {
+				opts := defaultSubscriptionOptions()
+				Expect(opts.backpressure.policy).To(Equal(policyDropNewest))
+			})
+		})
+
+		Context("when DropOldest is set", func() {
+			It("drops the oldest messages", func() {
+				opts := defaultSubscriptionOptions()
+				DropOldest().applySubscription(&opts)
+				Expect(opts.backpressure.policy).To(Equal(policyDropOldest))
+			})
+		})
+
+		Context("when BlockWithTimeout is set", func() {
+			It("blocks with the given timeout", func() {
+				timeout := 123 * time.Millisecond
+				opts := defaultSubscriptionOptions()
+				BlockWithTimeout(timeout).applySubscription(&opts)
+				Expect(opts.backpressure).To(Equal(backpressure{policy: policyBlock, timeout: timeout}))
+			})
+		})
+
+		Context("when UnboundedQueue is set", func() {
+			It("does not drop messages", func() {
+				opts := defaultSubscriptionOptions()
+				UnboundedQueue().applySubscription(&opts)
+				Expect(opts.backpressure.policy).To(Equal(policyUnbounded))
+			})
+		})
+
+		Context("when more than one policy is set", func() {
+			It("uses the last one", func() {
+				opts := defaultSubscriptionOptions()
+				UnboundedQueue().applySubscription(&opts)
+				DropNewest().applySubscription(&opts)
+				Expect(opts.backpressure.policy).To(Equal(policyDropNewest))
+			})
+		})
+	})
+
+	Describe("SubscriptionCodec", func() {
+		Context("when the option is not set", func() {
+			It("does not override the codec", func() {
+				opts := defaultSubscriptionOptions()
+				Expect(opts.codec).To(BeNil())
+			})
+		})
+
+		Context("when the option is set", func() {
+			It("uses the given codec", func() {
+				opts := defaultSubscriptionOptions()
+				SubscriptionCodec(json.Codec).applySubscription(&opts)
+				Expect(opts.codec).To(Equal(json.Codec))
+			})
+		})
+	})
+
+	Describe("AsPattern", func() {
+		Context("when the option is not set", func() {
+			It("does not treat a topic as a pattern", func() {
+				opts := defaultSubscriptionOptions()
+				Expect(opts.pattern).To(BeFalse())
+			})
+		})
+
+		Context("when the option is set", func() {
+			It("treats a topic as a pattern", func() {
+				opts := defaultSubscriptionOptions()
+				AsPattern().applySubscription(&opts)
+				Expect(opts.pattern).To(BeTrue())
+			})
+		})
+	})
+})
+
+var _ = Describe("PublishOptions", func() {
+	Describe("WithHeaders", func() {
+		Context("when the option is not set", func() {
+			It("has no headers", func() {
+				opts := defaultPublishOptions()
+				Expect(opts.headers).To(BeNil())
+			})
+		})
+
+		Context("when the option is set more than once", func() {
+			It("merges the given headers", func() {
+				opts := defaultPublishOptions()
+				WithHeaders(map[string]string{"A": "1", "B": "2"}).applyPublish(&opts)
+				WithHeaders(map[string]string{"B": "3", "C": "4"}).applyPublish(&opts)
+				Expect(opts.headers).To(Equal(map[string]string{"A": "1", "B": "3", "C": "4"}))
+			})
+		})
+	})
+
+	Describe("WithMessageID", func() {
+		It("sets the message ID header", func() {
+			opts := defaultPublishOptions()
+			WithHeaders(map[string]string{"A": "1"}).applyPublish(&opts)
+			WithMessageID("kfp-001").applyPublish(&opts)
+			Expect(opts.headers).To(Equal(map[string]string{"A": "1", types.HeaderMessageID: "kfp-001"}))
+		})
+	})
+
+	Describe("WithTTL", func() {
+		It("sets the expiration header", func() {
+			ttl := time.Minute
+			before := time.Now()
+			opts := defaultPublishOptions()
+			WithTTL(ttl).applyPublish(&opts)
+			msg := &types.Message{Headers: opts.headers}
+			expiresAt, ok := msg.ExpiresAt()
+			Expect(ok).To(BeTrue())
+			Expect(expiresAt).To(BeTemporally(">=", before.Add(ttl)))
+			Expect(expiresAt).To(BeTemporally("<=", time.Now().Add(ttl)))
+		})
+	})
 })
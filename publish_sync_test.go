@@ -0,0 +1,89 @@
+package kiara_test
+
+import (
+	"context"
+	"errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/genkami/kiara"
+	"github.com/genkami/kiara/adapter/inmemory"
+	"github.com/genkami/kiara/types"
+)
+
+var errPublishFailed = errors.New("publish failed")
+
+// failingAdapter is an adapter that fails to publish any messages.
+type failingAdapter struct {
+	pipe *types.Pipe
+	done chan struct{}
+}
+
+func (a *failingAdapter) Start(pipe *types.Pipe) {
+	a.pipe = pipe
+	a.done = make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-a.done:
+				return
+			case msg := <-pipe.Publish:
+				if !msg.Complete(errPublishFailed) {
+					pipe.Errors <- &types.PublishError{Topic: msg.Topic, Err: errPublishFailed}
+				}
+			}
+		}
+	}()
+}
+
+func (a *failingAdapter) Subscribe(topic string) error   { return nil }
+func (a *failingAdapter) Unsubscribe(topic string) error { return nil }
+func (a *failingAdapter) Stop()                          { close(a.done) }
+
+var _ = Describe("PublishSync", func() {
+	Context("when the adapter succeeds in publishing the message", func() {
+		It("returns nil and the message is delivered", func() {
+			broker := inmemory.NewBroker()
+			defer broker.Close()
+			pubsub := kiara.NewPubSub(inmemory.NewAdapter(broker))
+			defer pubsub.Close()
+
+			topic := "room:123"
+			sub, err := kiara.Subscribe[int](pubsub, topic)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			err = kiara.PublishSync(ctx, pubsub, topic, 123)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(receive(sub.Channel())).To(Equal(123))
+		})
+	})
+
+	Context("when the adapter fails to publish the message", func() {
+		It("returns the error instead of reporting it through Errors()", func() {
+			pubsub := kiara.NewPubSub(&failingAdapter{})
+			defer pubsub.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			err := pubsub.PublishSync(ctx, "room:123", 123)
+			Expect(err).To(MatchError(errPublishFailed))
+			expectNoMessage(pubsub.Errors())
+		})
+	})
+
+	Context("when the message is published by Publish", func() {
+		It("reports the error through Errors()", func() {
+			pubsub := kiara.NewPubSub(&failingAdapter{})
+			defer pubsub.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			err := pubsub.Publish(ctx, "room:123", 123)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(receive(pubsub.Errors())).To(MatchError(errPublishFailed))
+		})
+	})
+})
@@ -0,0 +1,53 @@
+package kiara
+
+import (
+	"reflect"
+
+	"github.com/genkami/kiara/types"
+)
+
+// RawPayload is a payload that is already encoded.
+// It is published as it is without being marshaled by the codec, and destinations of type RawPayload receive payloads
+// as they are without unmarshaling them, which is useful for proxies and bridges.
+//
+// Note that []byte is marshaled and unmarshaled by the codec like any other types.
+type RawPayload []byte
+
+var (
+	messageType    = reflect.TypeOf((*types.Message)(nil))
+	rawPayloadType = reflect.TypeOf(RawPayload(nil))
+)
+
+// isRawType reports whether messages are sent to destinations of type `t` without being unmarshaled,
+// i.e. `t` is either *types.Message or RawPayload.
+func isRawType(t reflect.Type) bool {
+	return t == messageType || t == rawPayloadType
+}
+
+// rawValue returns the message of `d` as a value of `t`, which must satisfy isRawType.
+// The message is copied because it is shared by all subscriptions to the topic.
+func rawValue(t reflect.Type, d delivery) interface{} {
+	payload := append([]byte(nil), d.msg.Payload...)
+	if t == rawPayloadType {
+		return RawPayload(payload)
+	}
+	return &types.Message{Topic: d.msg.Topic, Headers: copyHeaders(d.msg.Headers), Payload: payload, Pattern: d.msg.Pattern}
+}
+
+// marshal encodes `data` with `codec` unless `data` is RawPayload, which is used as the payload as it is.
+// RawPayload is copied because it is published asynchronously while the caller may reuse it.
+func marshal(codec types.Codec, data interface{}) ([]byte, error) {
+	if payload, ok := data.(RawPayload); ok {
+		return append([]byte(nil), payload...), nil
+	}
+	return codec.Marshal(data)
+}
+
+// unmarshal decodes `payload` into `v` with `codec` unless `v` is *RawPayload, which is filled with a copy of `payload`.
+func unmarshal(codec types.Codec, payload []byte, v interface{}) error {
+	if raw, ok := v.(*RawPayload); ok {
+		*raw = append(RawPayload(nil), payload...)
+		return nil
+	}
+	return codec.Unmarshal(payload, v)
+}
@@ -0,0 +1,182 @@
+package kiara_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/genkami/kiara"
+	"github.com/genkami/kiara/adapter/inmemory"
+	json "github.com/genkami/kiara/codec/json"
+	"github.com/genkami/kiara/types"
+)
+
+var _ = Describe("Raw subscriptions", func() {
+	var (
+		broker *inmemory.Broker
+		pubsub *kiara.PubSub
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	topic := "room:123"
+
+	BeforeEach(func() {
+		broker = inmemory.NewBroker()
+		pubsub = kiara.NewPubSub(inmemory.NewAdapter(broker), kiara.WithCodec(json.Codec))
+		ctx, cancel = context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+	})
+
+	AfterEach(func() {
+		cancel()
+		pubsub.Close()
+		broker.Close()
+	})
+
+	Context("when the channel is chan kiara.RawPayload", func() {
+		It("receives the payload without unmarshaling", func() {
+			ch := make(chan kiara.RawPayload, 1)
+			sub, err := pubsub.Subscribe(topic, ch)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			err = pubsub.Publish(ctx, topic, account{Name: "Gura", Age: 9927})
+			Expect(err).NotTo(HaveOccurred())
+			select {
+			case payload := <-ch:
+				Expect(string(payload)).To(MatchJSON(`{"Name":"Gura","Age":9927}`))
+			case <-time.After(timeoutExpectedNotToExceed):
+				Fail("timeout")
+			}
+		})
+	})
+
+	Context("when the channel is chan *types.Message", func() {
+		It("receives the message as it is", func() {
+			ch := make(chan *types.Message, 1)
+			sub, err := pubsub.Subscribe(topic, ch)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			err = pubsub.Publish(ctx, topic, account{Name: "Gura", Age: 9927},
+				kiara.WithHeaders(map[string]string{"Correlation-Id": "kfp-001"}))
+			Expect(err).NotTo(HaveOccurred())
+			select {
+			case msg := <-ch:
+				Expect(msg.Topic).To(Equal(topic))
+				Expect(msg.Headers).To(HaveKeyWithValue("Correlation-Id", "kfp-001"))
+				Expect(msg.Payload).To(MatchJSON(`{"Name":"Gura","Age":9927}`))
+			case <-time.After(timeoutExpectedNotToExceed):
+				Fail("timeout")
+			}
+		})
+	})
+
+	Context("when T of Subscribe is kiara.RawPayload", func() {
+		It("receives the payload without unmarshaling", func() {
+			sub, err := kiara.Subscribe[kiara.RawPayload](pubsub, topic)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			err = pubsub.Publish(ctx, topic, 123)
+			Expect(err).NotTo(HaveOccurred())
+			select {
+			case payload := <-sub.Channel():
+				Expect(string(payload)).To(Equal("123"))
+			case <-time.After(timeoutExpectedNotToExceed):
+				Fail("timeout")
+			}
+		})
+	})
+
+	Context("when T of SubscribeDelivery is *types.Message", func() {
+		It("receives the message as it is", func() {
+			sub, err := kiara.SubscribeDelivery[*types.Message](pubsub, topic)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			err = pubsub.Publish(ctx, topic, 123)
+			Expect(err).NotTo(HaveOccurred())
+			select {
+			case d := <-sub.Channel():
+				Expect(d.Topic).To(Equal(topic))
+				Expect(string(d.Value.Payload)).To(Equal("123"))
+			case <-time.After(timeoutExpectedNotToExceed):
+				Fail("timeout")
+			}
+		})
+	})
+
+	Context("when the payload is []byte", func() {
+		It("marshals and unmarshals it with the codec", func() {
+			sub, err := kiara.Subscribe[[]byte](pubsub, topic)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			raw, err := kiara.Subscribe[kiara.RawPayload](pubsub, topic)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(raw.Unsubscribe()).NotTo(HaveOccurred()) }()
+			err = pubsub.Publish(ctx, topic, []byte("hello"))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(receive(sub.Channel())).To(Equal([]byte("hello")))
+			Expect(string(receive(raw.Channel()))).To(Equal(`"aGVsbG8="`))
+		})
+	})
+
+	Describe("Request", func() {
+		It("sends kiara.RawPayload to the responder without marshaling", func() {
+			sub, err := kiara.Respond(pubsub, "rpc:echo", func(_ context.Context, req kiara.RawPayload) (kiara.RawPayload, error) {
+				return append(kiara.RawPayload("echo: "), req...), nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			var resp kiara.RawPayload
+			err = pubsub.Request(ctx, "rpc:echo", kiara.RawPayload("hi"), &resp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(resp)).To(Equal("echo: hi"))
+		})
+	})
+
+	Describe("Publish", func() {
+		It("publishes kiara.RawPayload without marshaling", func() {
+			sub, err := kiara.Subscribe[kiara.RawPayload](pubsub, topic)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			err = pubsub.Publish(ctx, topic, kiara.RawPayload(`{"Name":"Gura","Age":9927}`))
+			Expect(err).NotTo(HaveOccurred())
+			select {
+			case payload := <-sub.Channel():
+				Expect(string(payload)).To(Equal(`{"Name":"Gura","Age":9927}`))
+			case <-time.After(timeoutExpectedNotToExceed):
+				Fail("timeout")
+			}
+		})
+
+		It("lets subscribers unmarshal the pre-encoded payload with the codec", func() {
+			sub, err := kiara.Subscribe[account](pubsub, topic)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			err = pubsub.Publish(ctx, topic, kiara.RawPayload(`{"Name":"Gura","Age":9927}`))
+			Expect(err).NotTo(HaveOccurred())
+			select {
+			case received := <-sub.Channel():
+				Expect(received).To(Equal(account{Name: "Gura", Age: 9927}))
+			case <-time.After(timeoutExpectedNotToExceed):
+				Fail("timeout")
+			}
+		})
+
+		It("does not publish modifications made to the payload after it returns", func() {
+			adapter := &stuckAdapter{}
+			pubsub := kiara.NewPubSub(adapter)
+			defer pubsub.Close()
+			buf := kiara.RawPayload("hello")
+			err := pubsub.Publish(ctx, topic, buf)
+			Expect(err).NotTo(HaveOccurred())
+			copy(buf, "XXXXX")
+			select {
+			case msg := <-adapter.pipe.Publish:
+				Expect(string(msg.Payload)).To(Equal("hello"))
+			case <-time.After(timeoutExpectedNotToExceed):
+				Fail("timeout")
+			}
+		})
+	})
+})
@@ -0,0 +1,271 @@
+package kiara
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"runtime/debug"
+
+	"github.com/genkami/kiara/types"
+)
+
+// headerError is a header that holds an error returned by a responder.
+const headerError = "Kiara-Error"
+
+// RemoteError is returned by PubSub.Request when the responder failed to handle the request.
+type RemoteError struct {
+	// Message is the error message returned by the responder.
+	Message string
+}
+
+func (e *RemoteError) Error() string {
+	return "remote error: " + e.Message
+}
+
+// Request publishes `req` to the given topic and waits for a reply from a responder registered by Respond.
+// The reply is unmarshaled into `resp`, which must be a pointer that the codec of the topic can unmarshal into.
+// The responder marshals the reply with the codec that it used to unmarshal the request.
+// `req` and `resp` may be RawPayload and *RawPayload respectively, in which case they are not marshaled or unmarshaled
+// as Publish and Subscribe do. So are Req and Resp of Respond.
+//
+// If the underlying adapter implements types.RequestAdapter (e.g. NATS), the request is sent through its native mechanism.
+// Otherwise, PubSub subscribes to a unique reply topic for each request and tells it to the responder with types.HeaderReplyTo.
+//
+// It returns ErrCancelled when `ctx` is done before a reply arrives, and *RemoteError when the responder returned an error.
+// It returns ErrDropped when a publish interceptor drops the request. When the adapter implements types.RequestAdapter,
+// it also returns ErrDropped when a delivery interceptor drops the reply; otherwise it waits for another reply.
+func (p *PubSub) Request(ctx context.Context, topic string, req interface{}, resp interface{}, options ...PublishOption) error {
+	opts := defaultPublishOptions()
+	for _, o := range options {
+		o.applyPublish(&opts)
+	}
+	codec := p.opts.codecOf(topic)
+	payload, err := marshal(codec, req)
+	if err != nil {
+		return err
+	}
+	msg := &types.Message{Topic: topic, Headers: opts.headers, Payload: payload}
+	var reply *types.Message
+	if adapter, ok := p.adapter.(types.RequestAdapter); ok {
+		reply, err = p.requestThroughAdapter(ctx, adapter, msg)
+		if err != nil && ctx.Err() != nil {
+			return ErrCancelled
+		}
+	} else {
+		reply, err = p.requestThroughReplyTopic(ctx, msg)
+	}
+	if err != nil {
+		return err
+	}
+	if errMsg, ok := reply.Headers[headerError]; ok {
+		return &RemoteError{Message: errMsg}
+	}
+	return unmarshal(codec, reply.Payload, resp)
+}
+
+func (p *PubSub) requestThroughAdapter(ctx context.Context, adapter types.RequestAdapter, msg *types.Message) (*types.Message, error) {
+	p.assignID(msg)
+	var reply *types.Message
+	err := p.interceptPublish(ctx, msg, func(ctx context.Context, msg *types.Message) error {
+		var err error
+		reply, err = adapter.Request(ctx, msg)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reply == nil {
+		return nil, ErrDropped
+	}
+	var intercepted *types.Message
+	err = p.interceptDelivery(ctx, nil, reply, func(_ context.Context, msg *types.Message) error {
+		intercepted = msg
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if intercepted == nil {
+		return nil, ErrDropped
+	}
+	return intercepted, nil
+}
+
+func (p *PubSub) requestThroughReplyTopic(ctx context.Context, msg *types.Message) (*types.Message, error) {
+	replyTopic, err := p.newReplyTopic()
+	if err != nil {
+		return nil, err
+	}
+	sink := newReplySink()
+	sub, err := p.subscribe([]string{replyTopic}, sink, defaultSubscriptionOptions())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := sub.Unsubscribe()
+		if err != nil {
+			p.reportError(err)
+		}
+	}()
+
+	msg.SetHeader(types.HeaderReplyTo, replyTopic)
+	dropped, err := p.publishIntercepted(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	if dropped {
+		return nil, ErrDropped
+	}
+
+	select {
+	case reply := <-sink.ch:
+		return reply, nil
+	case <-ctx.Done():
+		return nil, ErrCancelled
+	}
+}
+
+func (p *PubSub) newReplyTopic() (string, error) {
+	var id [16]byte
+	_, err := rand.Read(id[:])
+	if err != nil {
+		return "", err
+	}
+	return p.opts.replyTopicPrefix + hex.EncodeToString(id[:]), nil
+}
+
+// Respond registers a responder that handles requests sent to the given topic by PubSub.Request.
+// Requests are unmarshaled into Req and handled one by one in a dedicated goroutine.
+// A value or an error returned by `handler` is sent back to the requester.
+// If `handler` panics, the panic is recovered and sent back to the requester as an error, and is also reported through
+// PubSub.Errors() as *PanicError wrapped in *DeliveryError so that the responder can continue handling succeeding requests.
+//
+// The context passed to `handler` is cancelled once the returned Subscription is `Unsubscribe`d or the PubSub is closed.
+// The size of the queue of pending requests can be configured by SubscriptionChannelSize.
+func Respond[Req, Resp any](p *PubSub, topic string, handler func(ctx context.Context, req Req) (Resp, error), options ...SubscriptionOption) (*Subscription, error) {
+	opts := defaultSubscriptionOptions()
+	for _, o := range options {
+		o.applySubscription(&opts)
+	}
+	sink := newResponderSink(p, handler, opts.channelSize)
+	sub, err := p.subscribe([]string{topic}, sink, opts)
+	if err != nil {
+		return nil, err
+	}
+	go sink.run(sub)
+	return sub, nil
+}
+
+// replySink is a sink that receives a reply to a request as it is.
+type replySink struct {
+	ch chan *types.Message
+}
+
+func newReplySink() *replySink {
+	return &replySink{ch: make(chan *types.Message, 1)}
+}
+
+func (s *replySink) send(_ context.Context, d delivery) error {
+	select {
+	case s.ch <- d.msg:
+	default:
+		// Only the first reply is needed.
+	}
+	return nil
+}
+
+func (s *replySink) close() {}
+
+// responderSink is a sink that handles requests with a handler registered by Respond.
+type responderSink[Req, Resp any] struct {
+	pubSub  *PubSub
+	handler func(context.Context, Req) (Resp, error)
+	dec     decoder[Req]
+	queue   chan pendingRequest[Req]
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// pendingRequest is a request that is waiting to be handled.
+type pendingRequest[Req any] struct {
+	delivery
+	req Req
+}
+
+func newResponderSink[Req, Resp any](p *PubSub, handler func(context.Context, Req) (Resp, error), size int) *responderSink[Req, Resp] {
+	ctx, cancel := context.WithCancel(p.ctx)
+	return &responderSink[Req, Resp]{
+		pubSub:  p,
+		handler: handler,
+		dec:     newDecoder[Req](),
+		queue:   make(chan pendingRequest[Req], size),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+func (s *responderSink[Req, Resp]) send(ctx context.Context, d delivery) error {
+	req, err := s.dec.decodeDelivery(d)
+	if err != nil {
+		return err
+	}
+	return sendTo(ctx, s.queue, pendingRequest[Req]{delivery: d, req: req})
+}
+
+func (s *responderSink[Req, Resp]) close() {
+	s.cancel()
+	close(s.queue)
+}
+
+func (s *responderSink[Req, Resp]) run(sub *Subscription) {
+	for pending := range s.queue {
+		if s.ctx.Err() != nil {
+			// unsubscribed; discard pending requests
+			continue
+		}
+		err := s.handle(pending)
+		if err != nil {
+			s.pubSub.reportDeliveryError(sub, pending.msg, err)
+		}
+	}
+}
+
+func (s *responderSink[Req, Resp]) handle(pending pendingRequest[Req]) error {
+	resp, handlerErr := s.call(pending.ctx, pending.req)
+	var panicErr *PanicError
+	panicked := errors.As(handlerErr, &panicErr)
+	replyTo := pending.msg.Headers[types.HeaderReplyTo]
+	if replyTo == "" {
+		// The message was not sent by PubSub.Request, so no one waits for the reply.
+		return handlerErr
+	}
+	reply := &types.Message{Topic: replyTo}
+	if handlerErr != nil {
+		reply.Headers = map[string]string{headerError: handlerErr.Error()}
+	} else {
+		payload, err := marshal(pending.codec, resp)
+		if err != nil {
+			return err
+		}
+		reply.Payload = payload
+	}
+	err := s.pubSub.publishMessage(pending.ctx, reply)
+	if err != nil {
+		return &PublishError{Topic: replyTo, Err: err}
+	}
+	if panicked {
+		// Unlike errors returned by the handler, panics are reported even if the requester is notified.
+		return handlerErr
+	}
+	return nil
+}
+
+func (s *responderSink[Req, Resp]) call(ctx context.Context, req Req) (resp Resp, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return s.handler(ctx, req)
+}
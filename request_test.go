@@ -0,0 +1,179 @@
+package kiara_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/genkami/kiara"
+	"github.com/genkami/kiara/adapter/inmemory"
+	"github.com/genkami/kiara/types"
+)
+
+// echoAdapter is a types.RequestAdapter that replies to every request with its payload.
+type echoAdapter struct {
+	*inmemory.Adapter
+}
+
+func (a *echoAdapter) Request(ctx context.Context, msg *types.Message) (*types.Message, error) {
+	return &types.Message{Topic: msg.Topic, Payload: msg.Payload}, nil
+}
+
+var dropPublish = kiara.WithPublishInterceptors(func(ctx context.Context, msg *types.Message, next kiara.PublishFunc) error {
+	return nil
+})
+
+var dropDelivery = kiara.WithDeliveryInterceptors(func(ctx context.Context, sub *kiara.Subscription, msg *types.Message, next kiara.DeliverFunc) error {
+	return nil
+})
+
+var _ = Describe("Request", func() {
+	var (
+		broker *inmemory.Broker
+		pubsub *kiara.PubSub
+	)
+
+	BeforeEach(func() {
+		broker = inmemory.NewBroker()
+		adapter := inmemory.NewAdapter(broker)
+		pubsub = kiara.NewPubSub(adapter)
+	})
+
+	AfterEach(func() {
+		pubsub.Close()
+		broker.Close()
+	})
+
+	Context("when a responder is registered", func() {
+		It("receives a reply from the responder", func() {
+			topic := "rpc:upper"
+			sub, err := kiara.Respond(pubsub, topic, func(_ context.Context, req string) (string, error) {
+				return strings.ToUpper(req), nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			var resp string
+			err = pubsub.Request(ctx, topic, "kikkeriki", &resp)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp).To(Equal("KIKKERIKI"))
+		})
+
+		It("can handle more than one request", func() {
+			topic := "rpc:double"
+			sub, err := kiara.Respond(pubsub, topic, func(_ context.Context, req int) (int, error) {
+				return req * 2, nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+
+			for i := 0; i < 3; i++ {
+				ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+				defer cancel()
+				var resp int
+				err = pubsub.Request(ctx, topic, i, &resp)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resp).To(Equal(i * 2))
+			}
+		})
+	})
+
+	Context("when the responder returns an error", func() {
+		It("returns RemoteError", func() {
+			topic := "rpc:fail"
+			sub, err := kiara.Respond(pubsub, topic, func(_ context.Context, req string) (string, error) {
+				return "", errors.New("something went wrong")
+			})
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			var resp string
+			err = pubsub.Request(ctx, topic, "kikkeriki", &resp)
+			var remoteErr *kiara.RemoteError
+			Expect(errors.As(err, &remoteErr)).To(BeTrue())
+			Expect(remoteErr.Message).To(Equal("something went wrong"))
+		})
+	})
+
+	Context("when the responder panics", func() {
+		It("returns RemoteError and reports PanicError", func() {
+			topic := "rpc:panic"
+			sub, err := kiara.Respond(pubsub, topic, func(_ context.Context, req string) (string, error) {
+				panic("kikkeriki")
+			})
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			var resp string
+			err = pubsub.Request(ctx, topic, "kikkeriki", &resp)
+			var remoteErr *kiara.RemoteError
+			Expect(errors.As(err, &remoteErr)).To(BeTrue())
+			Expect(remoteErr.Message).To(ContainSubstring("kikkeriki"))
+			select {
+			case err := <-pubsub.Errors():
+				var panicErr *kiara.PanicError
+				Expect(errors.As(err, &panicErr)).To(BeTrue())
+				Expect(panicErr.Value).To(Equal("kikkeriki"))
+			case <-time.After(timeoutExpectedNotToExceed):
+				Fail("timeout")
+			}
+
+			err = pubsub.Request(ctx, topic, "kikkeriki", &resp)
+			Expect(errors.As(err, &remoteErr)).To(BeTrue())
+		})
+	})
+
+	Context("when an interceptor drops the request", func() {
+		It("returns ErrDropped without waiting for the context", func() {
+			pubsub := kiara.NewPubSub(inmemory.NewAdapter(broker), dropPublish)
+			defer pubsub.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			var resp string
+			err := pubsub.Request(ctx, "rpc:upper", "kikkeriki", &resp)
+			Expect(err).To(MatchError(kiara.ErrDropped))
+		})
+
+		It("returns ErrDropped when the adapter supports request/reply natively", func() {
+			pubsub := kiara.NewPubSub(&echoAdapter{Adapter: inmemory.NewAdapter(broker)}, dropPublish)
+			defer pubsub.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			var resp string
+			err := pubsub.Request(ctx, "rpc:echo", "kikkeriki", &resp)
+			Expect(err).To(MatchError(kiara.ErrDropped))
+		})
+	})
+
+	Context("when an interceptor drops the reply that arrived through the adapter", func() {
+		It("returns ErrDropped without waiting for the context", func() {
+			pubsub := kiara.NewPubSub(&echoAdapter{Adapter: inmemory.NewAdapter(broker)}, dropDelivery)
+			defer pubsub.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			var resp string
+			err := pubsub.Request(ctx, "rpc:echo", "kikkeriki", &resp)
+			Expect(err).To(MatchError(kiara.ErrDropped))
+		})
+	})
+
+	Context("when no responder is registered", func() {
+		It("returns ErrCancelled after the context is done", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedToExceed)
+			defer cancel()
+			var resp string
+			err := pubsub.Request(ctx, "rpc:nobody", "kikkeriki", &resp)
+			Expect(err).To(MatchError(kiara.ErrCancelled))
+		})
+	})
+})
@@ -0,0 +1,189 @@
+package kiara
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/genkami/kiara/types"
+)
+
+// PublishAt is the same as Publish except that the message is published at `at` instead of immediately.
+// The message is kept in the schedule store of the PubSub (see WithScheduleStore) until then.
+// It returns an error when it cannot marshal the message or store it. Any other errors are reported asynchronously via PubSub.Errors().
+//
+// Publish interceptors are called when the message is actually published, not when PublishAt is called.
+// Note that the TTL given by WithTTL starts when PublishAt is called.
+func (p *PubSub) PublishAt(ctx context.Context, topic string, data interface{}, at time.Time, options ...PublishOption) error {
+	opts := defaultPublishOptions()
+	for _, o := range options {
+		o.applyPublish(&opts)
+	}
+	payload, err := marshal(p.opts.codecOf(topic), data)
+	if err != nil {
+		return err
+	}
+	msg := &types.Message{Topic: topic, Headers: opts.headers, Payload: payload}
+	// The ID must be assigned here so that a message does not get different IDs when it is put back to the store.
+	p.assignID(msg)
+	p.publishLock.RLock()
+	closing := p.closing
+	p.publishLock.RUnlock()
+	if closing {
+		return ErrClosed
+	}
+	err = p.opts.scheduleStore.Add(ctx, msg, at)
+	if err != nil {
+		return err
+	}
+	select {
+	case p.scheduleWake <- struct{}{}:
+	default:
+		// The scheduler has already been woken up.
+	}
+	return nil
+}
+
+// PublishAfter is the same as PublishAt except that the message is published after `delay` elapses.
+func (p *PubSub) PublishAfter(ctx context.Context, topic string, data interface{}, delay time.Duration, options ...PublishOption) error {
+	return p.PublishAt(ctx, topic, data, time.Now().Add(delay), options...)
+}
+
+// runScheduler publishes messages in the schedule store once their scheduled time comes.
+// It checks the store at least every `schedulePollInterval` because other PubSubs sharing the store may add messages to it.
+func (p *PubSub) runScheduler() {
+	defer close(p.schedulerDone)
+	ctx := p.schedulerCtx
+	store := p.opts.scheduleStore
+	for {
+		p.publishDue(ctx)
+		wait := p.opts.schedulePollInterval
+		next, ok, err := store.Next(ctx)
+		if err != nil && ctx.Err() == nil {
+			p.reportError(err)
+		} else if ok {
+			if d := time.Until(next); d < wait {
+				wait = d
+			}
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-p.scheduleWake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// publishDue publishes messages whose scheduled time has come.
+func (p *PubSub) publishDue(ctx context.Context) {
+	store := p.opts.scheduleStore
+	now := time.Now()
+	msgs, err := store.Due(ctx, now)
+	if err != nil && ctx.Err() == nil {
+		p.reportError(err)
+	}
+	for i, msg := range msgs {
+		err := p.publishMessage(ctx, msg)
+		if errors.Is(err, ErrClosed) || errors.Is(err, ErrCancelled) {
+			// The PubSub is stopping. The messages have already been removed from the store,
+			// so they must be put back in order not to lose them.
+			for _, m := range msgs[i:] {
+				err := store.Add(context.Background(), m, now)
+				if err != nil {
+					p.reportError(&PublishError{Topic: m.Topic, Err: err})
+				}
+			}
+			return
+		}
+		if err != nil {
+			p.reportError(&PublishError{Topic: msg.Topic, Err: err})
+		}
+	}
+}
+
+// stopScheduler stops `runScheduler` and waits for it to exit.
+// Messages that are not published yet remain in the schedule store.
+func (p *PubSub) stopScheduler() {
+	p.stopSchedulerFunc()
+	<-p.schedulerDone
+}
+
+// NewMemoryScheduleStore returns a types.ScheduleStore that keeps messages in memory.
+// This is the default store of PubSub. Messages in the store are lost when the process exits.
+func NewMemoryScheduleStore() types.ScheduleStore {
+	return &memoryScheduleStore{}
+}
+
+type memoryScheduleStore struct {
+	lock     sync.Mutex
+	messages scheduledHeap
+	seq      uint64
+}
+
+func (s *memoryScheduleStore) Add(_ context.Context, msg *types.Message, at time.Time) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.seq++
+	heap.Push(&s.messages, scheduledMessage{
+		msg: &types.Message{Topic: msg.Topic, Headers: msg.Headers, Payload: msg.Payload},
+		at:  at,
+		seq: s.seq,
+	})
+	return nil
+}
+
+func (s *memoryScheduleStore) Due(_ context.Context, now time.Time) ([]*types.Message, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var msgs []*types.Message
+	for len(s.messages) > 0 && !s.messages[0].at.After(now) {
+		msgs = append(msgs, heap.Pop(&s.messages).(scheduledMessage).msg)
+	}
+	return msgs, nil
+}
+
+func (s *memoryScheduleStore) Next(_ context.Context) (time.Time, bool, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.messages) <= 0 {
+		return time.Time{}, false, nil
+	}
+	return s.messages[0].at, true, nil
+}
+
+type scheduledMessage struct {
+	msg *types.Message
+	at  time.Time
+	seq uint64 // keeps messages scheduled at the same time in order of addition
+}
+
+// scheduledHeap is a heap.Interface of scheduledMessage, from the earliest.
+type scheduledHeap []scheduledMessage
+
+func (h scheduledHeap) Len() int { return len(h) }
+
+func (h scheduledHeap) Less(i, j int) bool {
+	if h[i].at.Equal(h[j].at) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].at.Before(h[j].at)
+}
+
+func (h scheduledHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *scheduledHeap) Push(x interface{}) { *h = append(*h, x.(scheduledMessage)) }
+
+func (h *scheduledHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = scheduledMessage{}
+	*h = old[:n-1]
+	return x
+}
@@ -0,0 +1,107 @@
+package kiara_test
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/genkami/kiara"
+	"github.com/genkami/kiara/adapter/inmemory"
+	"github.com/genkami/kiara/types"
+)
+
+var _ = Describe("Scheduled publish", func() {
+	var (
+		broker *inmemory.Broker
+		pubsub *kiara.PubSub
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	topic := "reminder:123"
+	delay := 100 * time.Millisecond
+
+	BeforeEach(func() {
+		broker = inmemory.NewBroker()
+		ctx, cancel = context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+	})
+
+	AfterEach(func() {
+		cancel()
+		pubsub.Close()
+		broker.Close()
+	})
+
+	Describe("PublishAfter", func() {
+		It("publishes the message after the delay", func() {
+			pubsub = newPubSub(broker)
+			sub := subscribe[int](pubsub, topic)
+			start := time.Now()
+			err := pubsub.PublishAfter(ctx, topic, 1, delay)
+			Expect(err).NotTo(HaveOccurred())
+			expectNoMessage(sub.Channel())
+			Expect(receive(sub.Channel())).To(Equal(1))
+			Expect(time.Since(start)).To(BeNumerically(">=", delay))
+		})
+	})
+
+	Describe("PublishAt", func() {
+		It("publishes messages in order of their scheduled time", func() {
+			pubsub = newPubSub(broker)
+			sub := subscribe[int](pubsub, topic)
+			now := time.Now()
+			Expect(pubsub.PublishAt(ctx, topic, 2, now.Add(2*delay))).To(Succeed())
+			Expect(pubsub.PublishAt(ctx, topic, 1, now.Add(delay))).To(Succeed())
+			Expect(receive(sub.Channel())).To(Equal(1))
+			Expect(receive(sub.Channel())).To(Equal(2))
+		})
+
+		Context("when the time has already passed", func() {
+			It("publishes the message immediately", func() {
+				pubsub = newPubSub(broker)
+				sub := subscribe[int](pubsub, topic)
+				err := pubsub.PublishAt(ctx, topic, 1, time.Now().Add(-time.Hour))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(receive(sub.Channel())).To(Equal(1))
+			})
+		})
+
+		Context("when the PubSub is closed", func() {
+			It("returns ErrClosed", func() {
+				pubsub = newPubSub(broker)
+				pubsub.Close()
+				err := pubsub.PublishAt(ctx, topic, 1, time.Now())
+				Expect(err).To(MatchError(kiara.ErrClosed))
+			})
+		})
+
+		It("calls publish interceptors when the message is published", func() {
+			intercepted := make(chan time.Time, 1)
+			pubsub = newPubSub(broker, kiara.WithPublishInterceptors(func(ctx context.Context, msg *types.Message, next kiara.PublishFunc) error {
+				intercepted <- time.Now()
+				return next(ctx, msg)
+			}))
+			sub := subscribe[int](pubsub, topic)
+			at := time.Now().Add(delay)
+			Expect(pubsub.PublishAt(ctx, topic, 1, at)).To(Succeed())
+			Expect(receive(sub.Channel())).To(Equal(1))
+			Expect(<-intercepted).To(BeTemporally(">=", at))
+		})
+	})
+
+	Context("when the schedule store is shared", func() {
+		It("publishes messages scheduled by a PubSub that has stopped", func() {
+			store := kiara.NewMemoryScheduleStore()
+			stopped := newPubSub(broker, kiara.WithScheduleStore(store))
+			err := stopped.PublishAfter(ctx, topic, 1, delay)
+			Expect(err).NotTo(HaveOccurred())
+			stopped.Close()
+
+			pubsub = newPubSub(broker, kiara.WithScheduleStore(store), kiara.SchedulePollInterval(delay))
+			sub := subscribe[int](pubsub, topic)
+			Expect(receive(sub.Channel())).To(Equal(1))
+		})
+	})
+})
@@ -0,0 +1,157 @@
+package kiara_test
+
+import (
+	"context"
+	"runtime"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/genkami/kiara"
+	"github.com/genkami/kiara/adapter/inmemory"
+	"github.com/genkami/kiara/types"
+)
+
+// stuckAdapter is an adapter that never publishes messages.
+// Messages remain in its pipe so that tests can inspect them.
+type stuckAdapter struct {
+	pipe *types.Pipe
+}
+
+func (a *stuckAdapter) Start(pipe *types.Pipe)         { a.pipe = pipe }
+func (a *stuckAdapter) Subscribe(topic string) error   { return nil }
+func (a *stuckAdapter) Unsubscribe(topic string) error { return nil }
+func (a *stuckAdapter) Stop()                          {}
+
+var _ = Describe("Shutdown", func() {
+	var (
+		broker *inmemory.Broker
+		pubsub *kiara.PubSub
+	)
+
+	BeforeEach(func() {
+		broker = inmemory.NewBroker()
+		adapter := inmemory.NewAdapter(broker)
+		pubsub = kiara.NewPubSub(adapter)
+	})
+
+	AfterEach(func() {
+		pubsub.Close()
+		broker.Close()
+	})
+
+	Context("when messages are still queued", func() {
+		It("publishes and delivers all of them before stopping", func() {
+			topic := "room:123"
+			n := 50
+			sub, err := kiara.Subscribe[int](pubsub, topic, kiara.SubscriptionChannelSize(n))
+			Expect(err).NotTo(HaveOccurred())
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			for i := 0; i < n; i++ {
+				err = pubsub.Publish(ctx, topic, i)
+				Expect(err).NotTo(HaveOccurred())
+			}
+			err = pubsub.Shutdown(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sub.Channel()).To(HaveLen(n), "messages must be delivered before Shutdown returns")
+			for i := 0; i < n; i++ {
+				Expect(receive(sub.Channel())).To(Equal(i))
+			}
+		})
+	})
+
+	Context("when the PubSub is shut down", func() {
+		It("refuses to publish messages", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			err := pubsub.Shutdown(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			err = pubsub.Publish(ctx, "room:123", 123)
+			Expect(err).To(MatchError(kiara.ErrClosed))
+		})
+
+		It("returns ErrClosed when called again", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			err := pubsub.Shutdown(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			err = pubsub.Shutdown(ctx)
+			Expect(err).To(MatchError(kiara.ErrClosed))
+		})
+	})
+
+	Context("when the context is done before the adapter publishes all messages", func() {
+		It("returns ErrCancelled", func() {
+			pubsub := kiara.NewPubSub(&stuckAdapter{})
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			err := pubsub.Publish(ctx, "room:123", 123)
+			Expect(err).NotTo(HaveOccurred())
+
+			shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), timeoutExpectedToExceed)
+			defer shutdownCancel()
+			err = pubsub.Shutdown(shutdownCtx)
+			Expect(err).To(MatchError(kiara.ErrCancelled))
+		})
+
+		It("makes PublishSync waiting for a queued message return ErrClosed", func() {
+			pubsub := kiara.NewPubSub(&stuckAdapter{})
+			result := make(chan error, 1)
+			go func() {
+				result <- pubsub.PublishSync(context.Background(), "room:123", 123)
+			}()
+			Eventually(func() int { return pubsub.Stats().PublishQueueDepth }).Should(Equal(1))
+
+			shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), timeoutExpectedToExceed)
+			defer shutdownCancel()
+			err := pubsub.Shutdown(shutdownCtx)
+			Expect(err).To(MatchError(kiara.ErrCancelled))
+			Eventually(result).Should(Receive(MatchError(kiara.ErrClosed)))
+		})
+	})
+
+	Context("when the PubSub is closed while messages are still queued", func() {
+		It("makes PublishSync waiting for them return ErrClosed", func() {
+			pubsub := kiara.NewPubSub(&stuckAdapter{})
+			result := make(chan error, 1)
+			go func() {
+				result <- pubsub.PublishSync(context.Background(), "room:123", 123)
+			}()
+			Eventually(func() int { return pubsub.Stats().PublishQueueDepth }).Should(Equal(1))
+
+			pubsub.Close()
+			Eventually(result).Should(Receive(MatchError(kiara.ErrClosed)))
+		})
+	})
+	Context("when the PubSub is closed while subscriptions remain", func() {
+		It("closes channels owned by the PubSub", func() {
+			sub, err := kiara.Subscribe[int](pubsub, "room:123")
+			Expect(err).NotTo(HaveOccurred())
+			pubsub.Close()
+			Eventually(sub.Channel()).Should(BeClosed())
+			Expect(sub.Unsubscribe()).NotTo(HaveOccurred())
+		})
+
+		It("stops all goroutines of the subscriptions", func() {
+			before := runtime.NumGoroutine()
+			for i := 0; i < 10; i++ {
+				pubsub := kiara.NewPubSub(inmemory.NewAdapter(broker))
+				_, err := kiara.SubscribeFunc(pubsub, "room:123", func(context.Context, int) error { return nil }, kiara.Workers(4))
+				Expect(err).NotTo(HaveOccurred())
+				_, err = kiara.Respond(pubsub, "rpc:echo", func(_ context.Context, req int) (int, error) { return req, nil })
+				Expect(err).NotTo(HaveOccurred())
+				_, err = kiara.Subscribe[int](pubsub, "room:123", kiara.UnboundedQueue())
+				Expect(err).NotTo(HaveOccurred())
+				pubsub.Close()
+			}
+			Eventually(runtime.NumGoroutine).Should(BeNumerically("<=", before))
+		})
+
+		It("refuses new subscriptions", func() {
+			pubsub.Close()
+			_, err := kiara.Subscribe[int](pubsub, "room:123")
+			Expect(err).To(MatchError(kiara.ErrClosed))
+		})
+	})
+})
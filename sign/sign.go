@@ -0,0 +1,266 @@
+// Package sign provides interceptors that sign messages on publish and verify them on delivery,
+// so that messages injected into the broker by anyone else than publishers are rejected.
+//
+// The signature covers the topic, the payload, and the headers reserved by kiara that the message has when it is signed:
+// types.HeaderMessageID, types.HeaderExpiresAt and types.HeaderReplyTo. Other headers are not signed.
+//
+// Signing alone does not prevent a signed message from being replayed. Give messages IDs and TTLs by kiara.WithMessageIDs
+// and kiara.WithTTL, and make subscribers discard duplicates by kiara.WithDeduplication, in order to limit replays.
+// Note that adapters that support request/reply natively, such as NATS, carry reply addresses outside of headers,
+// so a reply address that is not signed is accepted.
+package sign
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/genkami/kiara"
+	"github.com/genkami/kiara/types"
+)
+
+var (
+	// This error is returned when a message is not signed.
+	ErrUnsigned = errors.New("message is not signed")
+
+	// This error is returned when a message is signed with a key that the Verifier does not have.
+	ErrUnknownKey = errors.New("unknown key")
+
+	// This error is returned when the signature of a message is not valid.
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+const (
+	// HeaderKeyID is a header that holds the ID of the key that signed the message.
+	HeaderKeyID = "Kiara-Signature-Key"
+
+	// HeaderSignature is a header that holds the signature of the message encoded in base64.
+	HeaderSignature = "Kiara-Signature"
+
+	// HeaderSignedHeaders is a header that holds a comma-separated list of headers covered by the signature.
+	HeaderSignedHeaders = "Kiara-Signed-Headers"
+)
+
+// signedHeaders are headers that are signed if the message has them when it is signed.
+var signedHeaders = []string{types.HeaderMessageID, types.HeaderExpiresAt, types.HeaderReplyTo}
+
+// unsignedHeaders are headers among `signedHeaders` that are accepted even if they are not signed,
+// because adapters that support request/reply natively add them when delivering messages.
+var unsignedHeaders = map[string]bool{types.HeaderReplyTo: true}
+
+// Signer signs messages.
+type Signer interface {
+	// Sign signs `data` and returns the ID of the key and the signature.
+	Sign(data []byte) (keyID string, signature []byte, err error)
+}
+
+// Verifier verifies signatures of messages.
+type Verifier interface {
+	// Verify verifies that `signature` is a valid signature of `data` signed with the key of `keyID`.
+	// It must return ErrUnknownKey if it does not have the key, or ErrInvalidSignature if the signature is not valid.
+	Verify(keyID string, data, signature []byte) error
+}
+
+// SignOnPublish returns an option that makes a PubSub sign every message it publishes with `signer`.
+//
+// Publish interceptors are called in the order they are given, so give this option after other publish interceptors
+// so that the signature covers modifications made by them.
+func SignOnPublish(signer Signer) kiara.Option {
+	return kiara.WithPublishInterceptors(signInterceptor(signer))
+}
+
+// VerifyOnDelivery returns an option that makes a PubSub verify every message with `verifier` before delivering it.
+//
+// Messages that are not signed or have invalid signatures are not delivered, and are reported through
+// PubSub.Errors() as *kiara.DeliveryError that wraps ErrUnsigned, ErrUnknownKey or ErrInvalidSignature.
+//
+// Give this option before other delivery interceptors so that messages are verified before others see them.
+func VerifyOnDelivery(verifier Verifier) kiara.Option {
+	return kiara.WithDeliveryInterceptors(verifyInterceptor(verifier))
+}
+
+func signInterceptor(signer Signer) kiara.PublishInterceptor {
+	return func(ctx context.Context, msg *types.Message, next kiara.PublishFunc) error {
+		var names []string
+		for _, name := range signedHeaders {
+			if _, ok := msg.Headers[name]; ok {
+				names = append(names, name)
+			}
+		}
+		keyID, signature, err := signer.Sign(signedData(msg, names))
+		if err != nil {
+			return err
+		}
+		headers := map[string]string{
+			HeaderKeyID:     keyID,
+			HeaderSignature: base64.StdEncoding.EncodeToString(signature),
+		}
+		if len(names) > 0 {
+			headers[HeaderSignedHeaders] = strings.Join(names, ",")
+		}
+		msg.SetHeaders(headers)
+		return next(ctx, msg)
+	}
+}
+
+func verifyInterceptor(verifier Verifier) kiara.DeliveryInterceptor {
+	return func(ctx context.Context, sub *kiara.Subscription, msg *types.Message, next kiara.DeliverFunc) error {
+		keyID, ok := msg.Headers[HeaderKeyID]
+		if !ok {
+			return ErrUnsigned
+		}
+		encoded, ok := msg.Headers[HeaderSignature]
+		if !ok {
+			return ErrUnsigned
+		}
+		signature, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return ErrInvalidSignature
+		}
+		names, err := signedHeaderNames(msg)
+		if err != nil {
+			return err
+		}
+		err = verifier.Verify(keyID, signedData(msg, names), signature)
+		if err != nil {
+			return err
+		}
+		return next(ctx, msg)
+	}
+}
+
+// signedHeaderNames returns headers listed in HeaderSignedHeaders of `msg`.
+// It returns ErrInvalidSignature if a listed header is missing, or a header that must be signed is not listed.
+func signedHeaderNames(msg *types.Message) ([]string, error) {
+	var names []string
+	if list, ok := msg.Headers[HeaderSignedHeaders]; ok {
+		names = strings.Split(list, ",")
+	}
+	listed := make(map[string]bool, len(names))
+	for _, name := range names {
+		if _, ok := msg.Headers[name]; !ok {
+			return nil, ErrInvalidSignature
+		}
+		listed[name] = true
+	}
+	for _, name := range signedHeaders {
+		if _, ok := msg.Headers[name]; ok && !listed[name] && !unsignedHeaders[name] {
+			return nil, ErrInvalidSignature
+		}
+	}
+	return names, nil
+}
+
+// signedData returns data to be signed: the topic, the number of signed headers, the name and the value of each of them,
+// and the payload. Everything except the payload is prefixed by its length in uvarint.
+func signedData(msg *types.Message, headers []string) []byte {
+	data := appendString(nil, msg.Topic)
+	data = appendUvarint(data, uint64(len(headers)))
+	for _, name := range headers {
+		data = appendString(data, name)
+		data = appendString(data, msg.Headers[name])
+	}
+	return append(data, msg.Payload...)
+}
+
+func appendString(data []byte, s string) []byte {
+	data = appendUvarint(data, uint64(len(s)))
+	return append(data, s...)
+}
+
+func appendUvarint(data []byte, n uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	l := binary.PutUvarint(b[:], n)
+	return append(data, b[:l]...)
+}
+
+// HMAC signs and verifies messages with HMAC-SHA256.
+type HMAC struct {
+	keyID  string
+	secret []byte
+}
+
+var (
+	_ Signer   = &HMAC{}
+	_ Verifier = &HMAC{}
+)
+
+// NewHMAC returns HMAC that uses `secret` as the key of `keyID`.
+func NewHMAC(keyID string, secret []byte) *HMAC {
+	return &HMAC{keyID: keyID, secret: secret}
+}
+
+func (h *HMAC) Sign(data []byte) (string, []byte, error) {
+	return h.keyID, h.mac(data), nil
+}
+
+func (h *HMAC) Verify(keyID string, data, signature []byte) error {
+	if keyID != h.keyID {
+		return fmt.Errorf("%w: %q", ErrUnknownKey, keyID)
+	}
+	if !hmac.Equal(h.mac(data), signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (h *HMAC) mac(data []byte) []byte {
+	m := hmac.New(sha256.New, h.secret)
+	m.Write(data)
+	return m.Sum(nil)
+}
+
+// Ed25519Signer signs messages with an Ed25519 private key.
+type Ed25519Signer struct {
+	keyID string
+	key   ed25519.PrivateKey
+}
+
+var _ Signer = &Ed25519Signer{}
+
+// NewEd25519Signer returns Ed25519Signer that signs with `key` as the key of `keyID`.
+func NewEd25519Signer(keyID string, key ed25519.PrivateKey) *Ed25519Signer {
+	return &Ed25519Signer{keyID: keyID, key: key}
+}
+
+func (s *Ed25519Signer) Sign(data []byte) (string, []byte, error) {
+	return s.keyID, ed25519.Sign(s.key, data), nil
+}
+
+// Ed25519Verifier verifies messages with Ed25519 public keys indexed by their key IDs.
+type Ed25519Verifier map[string]ed25519.PublicKey
+
+var _ Verifier = Ed25519Verifier{}
+
+func (v Ed25519Verifier) Verify(keyID string, data, signature []byte) error {
+	key, ok := v[keyID]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownKey, keyID)
+	}
+	if !ed25519.Verify(key, data, signature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// MultiVerifier is a Verifier that verifies messages with any of the given Verifiers that has the key.
+// This is useful to rotate keys, or to accept messages from publishers that use different algorithms.
+type MultiVerifier []Verifier
+
+var _ Verifier = MultiVerifier{}
+
+func (m MultiVerifier) Verify(keyID string, data, signature []byte) error {
+	for _, v := range m {
+		err := v.Verify(keyID, data, signature)
+		if !errors.Is(err, ErrUnknownKey) {
+			return err
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrUnknownKey, keyID)
+}
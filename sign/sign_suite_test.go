@@ -0,0 +1,13 @@
+package sign_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestSign(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Sign Suite")
+}
@@ -0,0 +1,244 @@
+package sign_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/genkami/kiara"
+	"github.com/genkami/kiara/adapter/inmemory"
+	"github.com/genkami/kiara/codec/gob"
+	"github.com/genkami/kiara/sign"
+	"github.com/genkami/kiara/types"
+)
+
+const (
+	timeoutExpectedNotToExceed = 3 * time.Second
+	timeoutExpectedToExceed    = 10 * time.Millisecond
+)
+
+var _ = Describe("Signing", func() {
+	var (
+		broker   *inmemory.Broker
+		pubsubs  []*kiara.PubSub
+		receiver *kiara.PubSub
+		sub      *kiara.TypedSubscription[int]
+	)
+
+	topic := "room:123"
+	secret := []byte("kikkeriki")
+
+	newPubSub := func(opts ...kiara.Option) *kiara.PubSub {
+		pubsub := kiara.NewPubSub(inmemory.NewAdapter(broker), opts...)
+		pubsubs = append(pubsubs, pubsub)
+		return pubsub
+	}
+
+	// rewrite modifies messages after they are signed.
+	rewrite := func(fn func(msg *types.Message)) kiara.Option {
+		return kiara.WithPublishInterceptors(func(ctx context.Context, msg *types.Message, next kiara.PublishFunc) error {
+			fn(msg)
+			return next(ctx, msg)
+		})
+	}
+
+	publish := func(pubsub *kiara.PubSub, topic string, data int, options ...kiara.PublishOption) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+		defer cancel()
+		Expect(pubsub.PublishSync(ctx, topic, data, options...)).NotTo(HaveOccurred())
+	}
+
+	expectDelivered := func(data int) {
+		select {
+		case received := <-sub.Channel():
+			Expect(received).To(Equal(data))
+		case <-time.After(timeoutExpectedNotToExceed):
+			Fail("timeout")
+		}
+	}
+
+	expectRejected := func(expected error) {
+		select {
+		case err := <-receiver.Errors():
+			Expect(err).To(MatchError(expected))
+			var deliveryErr *kiara.DeliveryError
+			Expect(errors.As(err, &deliveryErr)).To(BeTrue())
+		case <-time.After(timeoutExpectedNotToExceed):
+			Fail("timeout")
+		}
+		select {
+		case received := <-sub.Channel():
+			Fail(fmt.Sprintf("expected no message but got %v", received))
+		case <-time.After(timeoutExpectedToExceed):
+			// OK
+		}
+	}
+
+	subscribe := func(verifier sign.Verifier) {
+		receiver = newPubSub(sign.VerifyOnDelivery(verifier))
+		var err error
+		sub, err = kiara.Subscribe[int](receiver, topic)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		broker = inmemory.NewBroker()
+		pubsubs = nil
+	})
+
+	AfterEach(func() {
+		Expect(sub.Unsubscribe()).NotTo(HaveOccurred())
+		for _, p := range pubsubs {
+			p.Close()
+		}
+		broker.Close()
+	})
+
+	Context("with HMAC", func() {
+		BeforeEach(func() {
+			subscribe(sign.NewHMAC("key-1", secret))
+		})
+
+		It("delivers signed messages", func() {
+			publisher := newPubSub(sign.SignOnPublish(sign.NewHMAC("key-1", secret)))
+			publish(publisher, topic, 123)
+			expectDelivered(123)
+		})
+
+		It("rejects unsigned messages", func() {
+			publish(newPubSub(), topic, 123)
+			expectRejected(sign.ErrUnsigned)
+		})
+
+		It("rejects messages signed with another secret", func() {
+			publisher := newPubSub(sign.SignOnPublish(sign.NewHMAC("key-1", []byte("forged"))))
+			publish(publisher, topic, 123)
+			expectRejected(sign.ErrInvalidSignature)
+		})
+
+		It("rejects messages signed with an unknown key", func() {
+			publisher := newPubSub(sign.SignOnPublish(sign.NewHMAC("key-2", secret)))
+			publish(publisher, topic, 123)
+			expectRejected(sign.ErrUnknownKey)
+		})
+
+		It("rejects messages whose payload is modified", func() {
+			opts := []kiara.Option{sign.SignOnPublish(sign.NewHMAC("key-1", secret))}
+			opts = append(opts, rewrite(func(msg *types.Message) {
+				msg.Payload = append([]byte{}, msg.Payload...)
+				msg.Payload[len(msg.Payload)-1] ^= 1
+			}))
+			publish(newPubSub(opts...), topic, 123)
+			expectRejected(sign.ErrInvalidSignature)
+		})
+
+		It("delivers messages modified by interceptors given before it", func() {
+			modified, err := gob.Codec.Marshal(456)
+			Expect(err).NotTo(HaveOccurred())
+			modify := rewrite(func(msg *types.Message) {
+				msg.Payload = modified
+			})
+			publish(newPubSub(modify, sign.SignOnPublish(sign.NewHMAC("key-1", secret))), topic, 123)
+			expectDelivered(456)
+		})
+
+		It("delivers messages with signed headers", func() {
+			publisher := newPubSub(kiara.WithMessageIDs(), sign.SignOnPublish(sign.NewHMAC("key-1", secret)))
+			publish(publisher, topic, 123, kiara.WithTTL(time.Minute))
+			expectDelivered(123)
+		})
+
+		It("rejects messages whose ID is modified", func() {
+			opts := []kiara.Option{kiara.WithMessageIDs(), sign.SignOnPublish(sign.NewHMAC("key-1", secret))}
+			opts = append(opts, rewrite(func(msg *types.Message) {
+				msg.Headers[types.HeaderMessageID] = "kfp-001"
+			}))
+			publish(newPubSub(opts...), topic, 123)
+			expectRejected(sign.ErrInvalidSignature)
+		})
+
+		It("rejects messages whose expiration is removed", func() {
+			opts := []kiara.Option{sign.SignOnPublish(sign.NewHMAC("key-1", secret))}
+			opts = append(opts, rewrite(func(msg *types.Message) {
+				delete(msg.Headers, types.HeaderExpiresAt)
+			}))
+			publish(newPubSub(opts...), topic, 123, kiara.WithTTL(time.Minute))
+			expectRejected(sign.ErrInvalidSignature)
+		})
+
+		It("rejects messages whose ID is added after signing", func() {
+			opts := []kiara.Option{sign.SignOnPublish(sign.NewHMAC("key-1", secret))}
+			opts = append(opts, rewrite(func(msg *types.Message) {
+				msg.Headers[types.HeaderMessageID] = "kfp-001"
+			}))
+			publish(newPubSub(opts...), topic, 123)
+			expectRejected(sign.ErrInvalidSignature)
+		})
+
+		It("rejects messages whose reply address is modified", func() {
+			opts := []kiara.Option{sign.SignOnPublish(sign.NewHMAC("key-1", secret))}
+			opts = append(opts, rewrite(func(msg *types.Message) {
+				msg.Headers[types.HeaderReplyTo] = "attacker"
+			}))
+			publish(newPubSub(opts...), topic, 123, kiara.WithHeaders(map[string]string{types.HeaderReplyTo: "kfp"}))
+			expectRejected(sign.ErrInvalidSignature)
+		})
+
+		It("rejects messages signed for another topic", func() {
+			opts := []kiara.Option{sign.SignOnPublish(sign.NewHMAC("key-1", secret))}
+			opts = append(opts, rewrite(func(msg *types.Message) {
+				msg.Topic = topic
+			}))
+			publish(newPubSub(opts...), "room:456", 123)
+			expectRejected(sign.ErrInvalidSignature)
+		})
+	})
+
+	Context("with Ed25519", func() {
+		var (
+			privateKey ed25519.PrivateKey
+		)
+
+		BeforeEach(func() {
+			publicKey, key, err := ed25519.GenerateKey(rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			privateKey = key
+			subscribe(sign.MultiVerifier{
+				sign.NewHMAC("hmac", secret),
+				sign.Ed25519Verifier{"ed25519": publicKey},
+			})
+		})
+
+		It("delivers signed messages", func() {
+			publisher := newPubSub(sign.SignOnPublish(sign.NewEd25519Signer("ed25519", privateKey)))
+			publish(publisher, topic, 123)
+			expectDelivered(123)
+		})
+
+		It("delivers messages signed by any of MultiVerifier", func() {
+			publisher := newPubSub(sign.SignOnPublish(sign.NewHMAC("hmac", secret)))
+			publish(publisher, topic, 123)
+			expectDelivered(123)
+		})
+
+		It("rejects messages signed with another private key", func() {
+			_, forged, err := ed25519.GenerateKey(rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			publisher := newPubSub(sign.SignOnPublish(sign.NewEd25519Signer("ed25519", forged)))
+			publish(publisher, topic, 123)
+			expectRejected(sign.ErrInvalidSignature)
+		})
+
+		It("rejects messages signed with an unknown key", func() {
+			publisher := newPubSub(sign.SignOnPublish(sign.NewEd25519Signer("unknown", privateKey)))
+			publish(publisher, topic, 123)
+			expectRejected(sign.ErrUnknownKey)
+		})
+	})
+})
@@ -0,0 +1,251 @@
+package kiara
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"github.com/genkami/kiara/types"
+)
+
+// sink is a destination of messages that are delivered to a Subscription.
+type sink interface {
+	// send parses a message with the codec of `d` and sends the result to the destination.
+	// It waits until the destination becomes ready to receive or `ctx` is done, and returns ErrSlowConsumer in the latter case.
+	// It must not block when `ctx` is already done.
+	send(ctx context.Context, d delivery) error
+
+	// close is called once the Subscription is unsubscribed and no more messages are sent.
+	close()
+}
+
+// delivery is a message that is about to be sent to a sink.
+type delivery struct {
+	// ctx is the context of the message. It is derived from the context of the Subscription by delivery interceptors.
+	ctx   context.Context
+	codec types.Codec
+	msg   *types.Message
+
+	// receivedAt is the time when the PubSub received the message from the adapter.
+	receivedAt time.Time
+}
+
+// deliveryDecoder is implemented by *Delivery[T] so that a message can be sent with its metadata
+// to any destination whose type is Delivery[T].
+type deliveryDecoder interface {
+	// deliveryDecodeFunc returns a function that parses the payload of `d` and fills `dst` with the result
+	// and the metadata of `d`. `dst` must have the same type as the receiver, which may be nil.
+	// It is called once per sink so that the function can be reused for every message.
+	deliveryDecodeFunc() func(d delivery, dst interface{}) error
+}
+
+// deliveryDecodeFuncOf returns deliveryDecoder.deliveryDecodeFunc of `t` if `t` is a pointer to Delivery[T], or nil otherwise.
+func deliveryDecodeFuncOf(t reflect.Type) func(d delivery, dst interface{}) error {
+	dec, ok := reflect.Zero(t).Interface().(deliveryDecoder)
+	if !ok {
+		return nil
+	}
+	return dec.deliveryDecodeFunc()
+}
+
+// copyHeaders returns a copy of `headers`, or nil if `headers` is nil.
+// Headers handed to subscribers must be copied because a message is shared by all subscriptions to its topic.
+func copyHeaders(headers map[string]string) map[string]string {
+	if headers == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(headers))
+	for k, v := range headers {
+		copied[k] = v
+	}
+	return copied
+}
+
+// noWait is a context that is already done. It is passed to sink.send when it must not block.
+var noWait = func() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	return ctx
+}()
+
+// sendTo sends `data` to `ch`. It waits until `ch` becomes ready or `ctx` is done, and returns ErrSlowConsumer in the latter case.
+func sendTo[T any](ctx context.Context, ch chan<- T, data T) error {
+	// Try sending first so that it does not fail randomly when `ctx` is already done and `ch` is ready.
+	select {
+	case ch <- data:
+		return nil
+	default:
+	}
+	select {
+	case ch <- data:
+		return nil
+	case <-ctx.Done():
+		return ErrSlowConsumer
+	}
+}
+
+// reflectSink is a sink that sends messages to an arbitrary channel given by users.
+type reflectSink struct {
+	chanVal  reflect.Value
+	elemType reflect.Type
+
+	// dataType is the type of values that messages are parsed into. It is `*elemType` unless `elemType` is a pointer
+	// in order to avoid creating a pointer to pointer, or `elemType` itself otherwise.
+	dataType reflect.Type
+
+	// decodeWithMetadata is the deliveryDecoder.deliveryDecodeFunc of `dataType` if `elemType` is Delivery[T], or nil otherwise.
+	decodeWithMetadata func(d delivery, dst interface{}) error
+}
+
+func newReflectSink(channel interface{}) (*reflectSink, error) {
+	chanType := reflect.TypeOf(channel)
+	if chanType == nil || chanType.Kind() != reflect.Chan {
+		return nil, ErrArgumentMustBeChannel
+	}
+	if chanType.ChanDir()&reflect.SendDir == 0 {
+		return nil, ErrArgumentMustBeChannel
+	}
+	elemType := chanType.Elem()
+	dataType := elemType
+	if elemType.Kind() != reflect.Ptr {
+		dataType = reflect.PtrTo(elemType)
+	}
+	return &reflectSink{
+		chanVal:            reflect.ValueOf(channel),
+		elemType:           elemType,
+		dataType:           dataType,
+		decodeWithMetadata: deliveryDecodeFuncOf(dataType),
+	}, nil
+}
+
+func (s *reflectSink) send(ctx context.Context, d delivery) error {
+	if isRawType(s.elemType) {
+		return s.sendValue(ctx, reflect.ValueOf(rawValue(s.elemType, d)))
+	}
+	dataVal := reflect.New(s.dataType.Elem())
+	if s.decodeWithMetadata != nil {
+		err := s.decodeWithMetadata(d, dataVal.Interface())
+		if err != nil {
+			return err
+		}
+	} else {
+		err := d.codec.Unmarshal(d.msg.Payload, dataVal.Interface())
+		if err != nil {
+			return &unmarshalError{err: err}
+		}
+	}
+	if s.dataType != s.elemType {
+		// In this case the type of `dataVal` is `*elemType`. So we should `Indirect` it so that
+		// `dataVal` can be sent to `chanVal` (whose type is `chan<- elemType`).
+		dataVal = reflect.Indirect(dataVal)
+	}
+	return s.sendValue(ctx, dataVal)
+}
+
+// sendValue is the same as sendTo except that it sends `dataVal` through reflection.
+func (s *reflectSink) sendValue(ctx context.Context, dataVal reflect.Value) error {
+	if s.chanVal.TrySend(dataVal) {
+		return nil
+	}
+	chosen, _, _ := reflect.Select([]reflect.SelectCase{
+		{Dir: reflect.SelectSend, Chan: s.chanVal, Send: dataVal},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+	})
+	if chosen != 0 {
+		return ErrSlowConsumer
+	}
+	return nil
+}
+
+// The channel is owned by the user, so we must not close it.
+func (s *reflectSink) close() {}
+
+// chanSink is a sink that sends messages to a channel of T owned by kiara.
+type chanSink[T any] struct {
+	ch  chan T
+	dec decoder[T]
+}
+
+func newChanSink[T any](size int) *chanSink[T] {
+	return &chanSink[T]{
+		ch:  make(chan T, size),
+		dec: newDecoder[T](),
+	}
+}
+
+func (s *chanSink[T]) send(ctx context.Context, d delivery) error {
+	data, err := s.dec.decodeDelivery(d)
+	if err != nil {
+		return err
+	}
+	return sendTo(ctx, s.ch, data)
+}
+
+func (s *chanSink[T]) close() {
+	close(s.ch)
+}
+
+// decoder parses payloads into T. It is created once per sink so that nothing about T is examined per message.
+type decoder[T any] struct {
+	// alloc returns a new value that T points to if T is a pointer type. It is nil otherwise.
+	alloc func() T
+
+	// decodeWithMetadata is the deliveryDecoder.deliveryDecodeFunc of *T if T is Delivery[U], or nil otherwise.
+	decodeWithMetadata func(d delivery, dst interface{}) error
+
+	// rawType is T if it is a type that satisfies isRawType, or nil otherwise.
+	rawType reflect.Type
+}
+
+func newDecoder[T any]() decoder[T] {
+	var dec decoder[T]
+	// T is examined by reflection only here. `alloc` still needs reflect.New since T may be a pointer to any type.
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if isRawType(t) {
+		dec.rawType = t
+		return dec
+	}
+	if t.Kind() == reflect.Ptr {
+		elem := t.Elem()
+		dec.alloc = func() T {
+			return reflect.New(elem).Interface().(T)
+		}
+	}
+	if d, ok := interface{}((*T)(nil)).(deliveryDecoder); ok {
+		dec.decodeWithMetadata = d.deliveryDecodeFunc()
+	}
+	return dec
+}
+
+// decodeDelivery parses a delivered message into T.
+// If T is Delivery[U], the payload is parsed into U and T is filled with the metadata of the message as well.
+// If T is *types.Message or RawPayload, the message is not parsed at all.
+func (dec decoder[T]) decodeDelivery(d delivery) (T, error) {
+	if dec.rawType != nil {
+		return rawValue(dec.rawType, d).(T), nil
+	}
+	if dec.decodeWithMetadata == nil {
+		return dec.decode(d.codec, d.msg.Payload)
+	}
+	var data T
+	err := dec.decodeWithMetadata(d, &data)
+	return data, err
+}
+
+// decode parses a payload into T.
+// Like PubSub.Subscribe, it passes `*T` to the codec unless T is a pointer in order to
+// avoid passing a pointer to pointer.
+func (dec decoder[T]) decode(codec types.Codec, payload []byte) (T, error) {
+	var data T
+	var err error
+	if dec.alloc == nil {
+		err = codec.Unmarshal(payload, &data)
+	} else {
+		data = dec.alloc()
+		err = codec.Unmarshal(payload, data)
+	}
+	if err != nil {
+		return data, &unmarshalError{err: err}
+	}
+	return data, nil
+}
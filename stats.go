@@ -0,0 +1,150 @@
+package kiara
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/genkami/kiara/types"
+)
+
+// Stats is a snapshot of statistics of a PubSub.
+type Stats struct {
+	// Total is the sum of statistics of all topics.
+	Total TopicStats
+
+	// Topics are statistics of each topic.
+	// Reply topics that PubSub.Request creates for each request are not included here but only in Total.
+	Topics map[string]TopicStats
+
+	// PublishQueueDepth is the number of messages waiting to be published by the adapter.
+	PublishQueueDepth int
+
+	// DeliveredQueueDepth is the number of messages that arrived from the adapter and are waiting to be delivered.
+	DeliveredQueueDepth int
+
+	// Adapter is statistics collected by the underlying adapter.
+	// It is nil if the adapter does not implement types.StatsAdapter.
+	Adapter *types.AdapterStats
+}
+
+// TopicStats is statistics of messages of a topic.
+type TopicStats struct {
+	// Published is the number of messages sent to the adapter to be published.
+	Published uint64
+
+	// Delivered is the number of messages delivered to subscriptions.
+	// A message is counted once for each subscription it is delivered to.
+	Delivered uint64
+
+	// Dropped is the number of messages discarded because subscribers were too slow.
+	Dropped uint64
+
+	// UnmarshalFailures is the number of messages that could not be unmarshaled.
+	UnmarshalFailures uint64
+
+	// Duplicates is the number of messages discarded as duplicates by WithDeduplication.
+	// A message is counted once regardless of the number of subscriptions.
+	Duplicates uint64
+
+	// Expired is the number of messages discarded because they expired before being delivered (see WithTTL).
+	// A message is counted once regardless of the number of subscriptions.
+	// Messages discarded by the adapter are counted in AdapterStats instead.
+	Expired uint64
+}
+
+// Stats returns a snapshot of statistics collected since the PubSub is created.
+func (p *PubSub) Stats() Stats {
+	stats := p.stats.snapshot()
+	stats.PublishQueueDepth = len(p.publishCh)
+	stats.DeliveredQueueDepth = len(p.deliveredCh)
+	if adapter, ok := p.adapter.(types.StatsAdapter); ok {
+		adapterStats := adapter.Stats()
+		stats.Adapter = &adapterStats
+	}
+	return stats
+}
+
+// statsCollector collects statistics of a PubSub.
+type statsCollector struct {
+	lock   sync.Mutex
+	total  TopicStats
+	topics map[string]*TopicStats
+
+	// Topics that start with this prefix are not recorded in `topics` so that it does not grow without limit.
+	ignoredPrefix string
+}
+
+func newStatsCollector(ignoredPrefix string) *statsCollector {
+	return &statsCollector{
+		topics:        map[string]*TopicStats{},
+		ignoredPrefix: ignoredPrefix,
+	}
+}
+
+// record updates statistics of the given topic and the total by `fn`.
+func (c *statsCollector) record(topic string, fn func(*TopicStats)) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	fn(&c.total)
+	if c.ignoredPrefix != "" && strings.HasPrefix(topic, c.ignoredPrefix) {
+		return
+	}
+	stats, ok := c.topics[topic]
+	if !ok {
+		stats = &TopicStats{}
+		c.topics[topic] = stats
+	}
+	fn(stats)
+}
+
+func (c *statsCollector) published(topic string) {
+	c.record(topic, func(s *TopicStats) { s.Published++ })
+}
+
+func (c *statsCollector) delivered(topic string) {
+	c.record(topic, func(s *TopicStats) { s.Delivered++ })
+}
+
+func (c *statsCollector) duplicated(topic string) {
+	c.record(topic, func(s *TopicStats) { s.Duplicates++ })
+}
+
+func (c *statsCollector) expired(topic string) {
+	c.record(topic, func(s *TopicStats) { s.Expired++ })
+}
+
+// failed records a delivery that failed due to `err`.
+func (c *statsCollector) failed(topic string, err error) {
+	var unmarshalErr *unmarshalError
+	switch {
+	case errors.Is(err, ErrSlowConsumer):
+		c.record(topic, func(s *TopicStats) { s.Dropped++ })
+	case errors.As(err, &unmarshalErr):
+		c.record(topic, func(s *TopicStats) { s.UnmarshalFailures++ })
+	}
+}
+
+func (c *statsCollector) snapshot() Stats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	topics := make(map[string]TopicStats, len(c.topics))
+	for topic, stats := range c.topics {
+		topics[topic] = *stats
+	}
+	return Stats{Total: c.total, Topics: topics}
+}
+
+// unmarshalError is an error returned by the codec while unmarshaling a payload.
+// It is only used to tell unmarshal failures from other errors, so it looks like the underlying error.
+type unmarshalError struct {
+	err error
+}
+
+func (e *unmarshalError) Error() string {
+	return e.err.Error()
+}
+
+func (e *unmarshalError) Unwrap() error {
+	return e.err
+}
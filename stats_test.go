@@ -0,0 +1,141 @@
+package kiara_test
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/genkami/kiara"
+	"github.com/genkami/kiara/adapter/inmemory"
+)
+
+var _ = Describe("Stats", func() {
+	var (
+		broker *inmemory.Broker
+		pubsub *kiara.PubSub
+	)
+
+	BeforeEach(func() {
+		broker = inmemory.NewBroker()
+		adapter := inmemory.NewAdapter(broker)
+		pubsub = kiara.NewPubSub(adapter)
+	})
+
+	AfterEach(func() {
+		pubsub.Close()
+		broker.Close()
+	})
+
+	topicStats := func(topic string) func() kiara.TopicStats {
+		return func() kiara.TopicStats {
+			return pubsub.Stats().Topics[topic]
+		}
+	}
+
+	Context("when messages are published and delivered", func() {
+		It("counts them", func() {
+			topic := "room:123"
+			n := 3
+			sub, err := kiara.Subscribe[int](pubsub, topic)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			for i := 0; i < n; i++ {
+				err = pubsub.Publish(ctx, topic, i)
+				Expect(err).NotTo(HaveOccurred())
+			}
+			for i := 0; i < n; i++ {
+				select {
+				case <-sub.Channel():
+				case <-time.After(timeoutExpectedNotToExceed):
+					Fail("timeout")
+				}
+			}
+
+			// Messages are counted as delivered right after they are sent to subscribers.
+			expected := kiara.TopicStats{Published: uint64(n), Delivered: uint64(n)}
+			Eventually(topicStats(topic), timeoutExpectedNotToExceed).Should(Equal(expected))
+			stats := pubsub.Stats()
+			Expect(stats.Topics).To(HaveLen(1))
+			Expect(stats.Total).To(Equal(expected))
+			Expect(stats.Adapter).NotTo(BeNil())
+			Expect(stats.Adapter.Published).To(Equal(uint64(n)))
+			Expect(stats.Adapter.Delivered).To(Equal(uint64(n)))
+		})
+	})
+
+	Context("when the subscriber is too slow", func() {
+		It("counts messages dropped", func() {
+			topic := "room:123"
+			sub, err := kiara.Subscribe[int](pubsub, topic, kiara.SubscriptionChannelSize(1))
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			for i := 0; i < 3; i++ {
+				err = pubsub.Publish(ctx, topic, i)
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Eventually(topicStats(topic), timeoutExpectedNotToExceed).Should(Equal(kiara.TopicStats{Published: 3, Delivered: 1, Dropped: 2}))
+		})
+	})
+
+	Context("when the payload cannot be unmarshaled", func() {
+		It("counts the failure", func() {
+			topic := "room:123"
+			sub, err := kiara.Subscribe[account](pubsub, topic)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			err = pubsub.Publish(ctx, topic, "not an account")
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(topicStats(topic), timeoutExpectedNotToExceed).Should(Equal(kiara.TopicStats{Published: 1, UnmarshalFailures: 1}))
+		})
+	})
+
+	Context("when requests are sent", func() {
+		It("does not count reply topics separately", func() {
+			topic := "rpc:echo"
+			sub, err := kiara.Respond(pubsub, topic, func(_ context.Context, req string) (string, error) {
+				return req, nil
+			})
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			var resp string
+			err = pubsub.Request(ctx, topic, "kikkeriki", &resp)
+			Expect(err).NotTo(HaveOccurred())
+
+			// The reply may arrive before it is counted.
+			Eventually(func() uint64 { return pubsub.Stats().Total.Published }, timeoutExpectedNotToExceed).Should(Equal(uint64(2)))
+			stats := pubsub.Stats()
+			for t := range stats.Topics {
+				Expect(strings.HasPrefix(t, "_kiara.reply.")).To(BeFalse())
+			}
+			Expect(stats.Topics[topic].Published).To(Equal(uint64(1)))
+		})
+	})
+
+	Context("when the adapter does not publish messages", func() {
+		It("reports the depth of the publish queue", func() {
+			pubsub := kiara.NewPubSub(&stuckAdapter{})
+			defer pubsub.Close()
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			for i := 0; i < 3; i++ {
+				err := pubsub.Publish(ctx, "room:123", i)
+				Expect(err).NotTo(HaveOccurred())
+			}
+			stats := pubsub.Stats()
+			Expect(stats.PublishQueueDepth).To(Equal(3))
+			Expect(stats.DeliveredQueueDepth).To(BeZero())
+			Expect(stats.Adapter).To(BeNil())
+		})
+	})
+})
@@ -0,0 +1,55 @@
+package otel
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// options is a configuration of interceptors.
+type options struct {
+	tracerProvider trace.TracerProvider
+	propagator     propagation.TextMapPropagator
+	system         string
+}
+
+func defaultOptions() options {
+	return options{
+		tracerProvider: otel.GetTracerProvider(),
+		propagator:     otel.GetTextMapPropagator(),
+	}
+}
+
+// Option configures interceptors.
+type Option interface {
+	apply(*options)
+}
+
+type optionFunc func(*options)
+
+func (f optionFunc) apply(opts *options) {
+	f(opts)
+}
+
+// TracerProvider sets a TracerProvider that creates spans. The default is the global one.
+func TracerProvider(provider trace.TracerProvider) Option {
+	return optionFunc(func(opts *options) {
+		opts.tracerProvider = provider
+	})
+}
+
+// Propagator sets a propagator that injects span contexts into headers and extracts them from headers.
+// The default is the global one.
+func Propagator(propagator propagation.TextMapPropagator) Option {
+	return optionFunc(func(opts *options) {
+		opts.propagator = propagator
+	})
+}
+
+// System sets the value of the `messaging.system` attribute of spans, such as "redis" or "nats".
+// The attribute is omitted by default.
+func System(system string) Option {
+	return optionFunc(func(opts *options) {
+		opts.system = system
+	})
+}
@@ -0,0 +1,97 @@
+// Package otel provides interceptors that propagate OpenTelemetry trace context through messages of kiara.PubSub.
+package otel
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/genkami/kiara"
+	"github.com/genkami/kiara/types"
+)
+
+const instrumentationName = "github.com/genkami/kiara/tracing/otel"
+
+// Interceptors returns options that make a PubSub trace messages with OpenTelemetry.
+//
+// The publish interceptor starts a producer span as a child of the context passed to PubSub.Publish, and injects
+// its span context into headers of the message. The delivery interceptor extracts the span context from headers and
+// starts a consumer span as its child. The context that has the consumer span is passed to SubscribeFunc handlers
+// and Respond handlers, and is available as Delivery.Context, so that subscribers can continue the trace.
+//
+// Note that the producer span ends once the message is queued to be published, and the consumer span ends once
+// the message is handed over to the subscriber, since PubSub does not know when they are actually processed.
+func Interceptors(options ...Option) []kiara.Option {
+	opts := defaultOptions()
+	for _, o := range options {
+		o.apply(&opts)
+	}
+	t := &tracer{
+		tracer:     opts.tracerProvider.Tracer(instrumentationName),
+		propagator: opts.propagator,
+		system:     opts.system,
+	}
+	return []kiara.Option{
+		kiara.WithPublishInterceptors(t.interceptPublish),
+		kiara.WithDeliveryInterceptors(t.interceptDelivery),
+	}
+}
+
+type tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+	system     string
+}
+
+func (t *tracer) interceptPublish(ctx context.Context, msg *types.Message, next kiara.PublishFunc) error {
+	ctx, span := t.tracer.Start(ctx, msg.Topic+" send",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(t.attributes(msg)...),
+	)
+	defer span.End()
+
+	carrier := propagation.MapCarrier{}
+	t.propagator.Inject(ctx, carrier)
+	msg.SetHeaders(carrier)
+
+	err := next(ctx, msg)
+	recordError(span, err)
+	return err
+}
+
+func (t *tracer) interceptDelivery(ctx context.Context, _ *kiara.Subscription, msg *types.Message, next kiara.DeliverFunc) error {
+	ctx = t.propagator.Extract(ctx, propagation.MapCarrier(msg.Headers))
+	attrs := append(t.attributes(msg), semconv.MessagingOperationReceive)
+	ctx, span := t.tracer.Start(ctx, msg.Topic+" receive",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attrs...),
+	)
+	defer span.End()
+	err := next(ctx, msg)
+	recordError(span, err)
+	return err
+}
+
+func (t *tracer) attributes(msg *types.Message) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		semconv.MessagingDestinationKey.String(msg.Topic),
+		semconv.MessagingDestinationKindTopic,
+		semconv.MessagingMessagePayloadSizeBytesKey.Int(len(msg.Payload)),
+	}
+	if t.system != "" {
+		attrs = append(attrs, semconv.MessagingSystemKey.String(t.system))
+	}
+	return attrs
+}
+
+func recordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
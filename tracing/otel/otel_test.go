@@ -0,0 +1,157 @@
+package otel_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/genkami/kiara"
+	"github.com/genkami/kiara/adapter/inmemory"
+	"github.com/genkami/kiara/tracing/otel"
+	"github.com/genkami/kiara/types"
+)
+
+const timeoutExpectedNotToExceed = 3 * time.Second
+
+var _ = Describe("Interceptors", func() {
+	var (
+		broker   *inmemory.Broker
+		exporter *tracetest.InMemoryExporter
+		provider *sdktrace.TracerProvider
+		pubsub   *kiara.PubSub
+	)
+
+	BeforeEach(func() {
+		broker = inmemory.NewBroker()
+		exporter = tracetest.NewInMemoryExporter()
+		provider = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+		options := otel.Interceptors(
+			otel.TracerProvider(provider),
+			otel.Propagator(propagation.TraceContext{}),
+			otel.System("inmemory"),
+		)
+		pubsub = kiara.NewPubSub(inmemory.NewAdapter(broker), options...)
+	})
+
+	AfterEach(func() {
+		pubsub.Close()
+		broker.Close()
+		Expect(provider.Shutdown(context.Background())).NotTo(HaveOccurred())
+	})
+
+	spansOfKind := func(kind trace.SpanKind) func() tracetest.SpanStubs {
+		return func() tracetest.SpanStubs {
+			var spans tracetest.SpanStubs
+			for _, s := range exporter.GetSpans() {
+				if s.SpanKind == kind {
+					spans = append(spans, s)
+				}
+			}
+			return spans
+		}
+	}
+
+	It("continues the trace of the publisher on delivery", func() {
+		topic := "room:123"
+		sub, err := kiara.SubscribeDelivery[int](pubsub, topic)
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+		defer cancel()
+		ctx, parent := provider.Tracer("test").Start(ctx, "parent")
+		err = pubsub.Publish(ctx, topic, 123)
+		Expect(err).NotTo(HaveOccurred())
+		parent.End()
+
+		var d kiara.Delivery[int]
+		Eventually(sub.Channel(), timeoutExpectedNotToExceed).Should(Receive(&d))
+		Eventually(spansOfKind(trace.SpanKindConsumer), timeoutExpectedNotToExceed).Should(HaveLen(1))
+		producer := spansOfKind(trace.SpanKindProducer)()
+		Expect(producer).To(HaveLen(1))
+		consumer := spansOfKind(trace.SpanKindConsumer)()
+
+		traceID := parent.SpanContext().TraceID()
+		Expect(producer[0].Parent.SpanID()).To(Equal(parent.SpanContext().SpanID()))
+		Expect(consumer[0].SpanContext.TraceID()).To(Equal(traceID))
+		Expect(consumer[0].Parent.SpanID()).To(Equal(producer[0].SpanContext.SpanID()))
+		Expect(consumer[0].Parent.IsRemote()).To(BeTrue())
+		Expect(consumer[0].Name).To(Equal(topic + " receive"))
+
+		// Subscribers can continue the trace from the context of the delivery.
+		received := trace.SpanContextFromContext(d.Context)
+		Expect(received.TraceID()).To(Equal(traceID))
+		Expect(received.SpanID()).To(Equal(consumer[0].SpanContext.SpanID()))
+	})
+
+	It("passes the context with the consumer span to handlers", func() {
+		topic := "room:123"
+		received := make(chan trace.SpanContext, 1)
+		sub, err := kiara.SubscribeFunc(pubsub, topic, func(ctx context.Context, _ int) error {
+			received <- trace.SpanContextFromContext(ctx)
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+		defer cancel()
+		ctx, parent := provider.Tracer("test").Start(ctx, "parent")
+		defer parent.End()
+		err = pubsub.Publish(ctx, topic, 123)
+		Expect(err).NotTo(HaveOccurred())
+
+		var sc trace.SpanContext
+		Eventually(received, timeoutExpectedNotToExceed).Should(Receive(&sc))
+		Expect(sc.TraceID()).To(Equal(parent.SpanContext().TraceID()))
+	})
+
+	It("propagates the trace through requests and replies", func() {
+		topic := "rpc:echo"
+		sub, err := kiara.Respond(pubsub, topic, func(_ context.Context, req string) (string, error) {
+			return req, nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+		defer cancel()
+		ctx, parent := provider.Tracer("test").Start(ctx, "parent")
+		var resp string
+		err = pubsub.Request(ctx, topic, "kikkeriki", &resp)
+		Expect(err).NotTo(HaveOccurred())
+		parent.End()
+
+		// request, reply
+		Eventually(spansOfKind(trace.SpanKindConsumer), timeoutExpectedNotToExceed).Should(HaveLen(2))
+		for _, s := range exporter.GetSpans() {
+			Expect(s.SpanContext.TraceID()).To(Equal(parent.SpanContext().TraceID()))
+		}
+	})
+
+	It("records an error when the message is rejected", func() {
+		errRejected := errors.New("rejected")
+		reject := kiara.WithPublishInterceptors(func(ctx context.Context, msg *types.Message, next kiara.PublishFunc) error {
+			return errRejected
+		})
+		options := append(otel.Interceptors(otel.TracerProvider(provider)), reject)
+		pubsub := kiara.NewPubSub(inmemory.NewAdapter(broker), options...)
+		defer pubsub.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+		defer cancel()
+		err := pubsub.Publish(ctx, "room:123", 123)
+		Expect(err).To(MatchError(errRejected))
+		producer := spansOfKind(trace.SpanKindProducer)()
+		Expect(producer).To(HaveLen(1))
+		Expect(producer[0].Status.Code).To(Equal(codes.Error))
+	})
+})
@@ -0,0 +1,102 @@
+package kiara
+
+import (
+	"context"
+	"time"
+)
+
+// TypedSubscription is a Subscription whose messages are delivered through a channel of T.
+type TypedSubscription[T any] struct {
+	*Subscription
+	ch <-chan T
+}
+
+// Channel returns a channel through which messages are delivered.
+// The channel is closed when the subscription is `Unsubscribe`d or the PubSub is closed.
+func (s *TypedSubscription[T]) Channel() <-chan T {
+	return s.ch
+}
+
+// Subscribe subscribes to the given topic and returns a TypedSubscription that receives messages as T.
+//
+// Unlike PubSub.Subscribe, the type of messages is checked at compile time and the channel is
+// created and owned by the PubSub.
+//
+// Note that PubSub internally passes *T to its internal codec when T is not a pointer, as PubSub.Subscribe does.
+// Messages are not unmarshaled when T is *types.Message or RawPayload, as PubSub.Subscribe does.
+func Subscribe[T any](p *PubSub, topic string, options ...SubscriptionOption) (*TypedSubscription[T], error) {
+	return SubscribeTopics[T](p, []string{topic}, options...)
+}
+
+// SubscribeTopics is the same as Subscribe except that it subscribes to all the given topics at once.
+// Use Delivery[U] as T to tell which topic each message comes from. See PubSub.SubscribeTopics for details.
+func SubscribeTopics[T any](p *PubSub, topics []string, options ...SubscriptionOption) (*TypedSubscription[T], error) {
+	opts := defaultSubscriptionOptions()
+	for _, o := range options {
+		o.applySubscription(&opts)
+	}
+	sink := newChanSink[T](opts.channelSize)
+	sub, err := p.subscribe(topics, sink, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedSubscription[T]{Subscription: sub, ch: sink.ch}, nil
+}
+
+// Delivery is a message delivered to a subscriber together with its metadata.
+// It can be used as the element type of channels passed to PubSub.Subscribe and PubSub.SubscribeTopics,
+// or as the type parameter of Subscribe, SubscribeTopics and SubscribeFunc.
+type Delivery[T any] struct {
+	// Context is the context of the message. It carries values that delivery interceptors attached to the message,
+	// such as a span extracted from the headers, and is cancelled once the subscription is `Unsubscribe`d.
+	Context context.Context
+
+	// Topic is the topic that the message was published to.
+	Topic string
+
+	// Headers are the headers attached to the message by WithHeaders. It may be nil.
+	// Each Delivery has its own copy, so subscribers may modify it.
+	Headers map[string]string
+
+	// ReceivedAt is the time when the PubSub received the message from the underlying message broker.
+	ReceivedAt time.Time
+
+	// Value is the unmarshaled payload.
+	Value T
+}
+
+func (*Delivery[T]) deliveryDecodeFunc() func(d delivery, dst interface{}) error {
+	dec := newDecoder[T]()
+	return func(d delivery, dst interface{}) error {
+		value, err := dec.decodeDelivery(d)
+		if err != nil {
+			return err
+		}
+		*dst.(*Delivery[T]) = Delivery[T]{
+			Context:    d.ctx,
+			Topic:      d.msg.Topic,
+			Headers:    copyHeaders(d.msg.Headers),
+			ReceivedAt: d.receivedAt,
+			Value:      value,
+		}
+		return nil
+	}
+}
+
+// SubscribeDelivery is the same as Subscribe except that messages are delivered as Delivery
+// so that subscribers can access metadata of messages such as headers.
+// It is a shorthand for Subscribe[Delivery[T]].
+func SubscribeDelivery[T any](p *PubSub, topic string, options ...SubscriptionOption) (*TypedSubscription[Delivery[T]], error) {
+	return Subscribe[Delivery[T]](p, topic, options...)
+}
+
+// Publish publishes `data` to the underlying message broker.
+// It is the same as PubSub.Publish except that the type of `data` is checked at compile time.
+func Publish[T any](ctx context.Context, p *PubSub, topic string, data T, options ...PublishOption) error {
+	return p.Publish(ctx, topic, data, options...)
+}
+
+// PublishSync is the same as PubSub.PublishSync except that the type of `data` is checked at compile time.
+func PublishSync[T any](ctx context.Context, p *PubSub, topic string, data T, options ...PublishOption) error {
+	return p.PublishSync(ctx, topic, data, options...)
+}
@@ -0,0 +1,201 @@
+package kiara_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/genkami/kiara"
+	"github.com/genkami/kiara/adapter/inmemory"
+)
+
+type account struct {
+	Name string
+	Age  int
+}
+
+var _ = Describe("Typed", func() {
+	var (
+		broker *inmemory.Broker
+		pubsub *kiara.PubSub
+	)
+
+	BeforeEach(func() {
+		broker = inmemory.NewBroker()
+		adapter := inmemory.NewAdapter(broker)
+		pubsub = kiara.NewPubSub(adapter)
+	})
+
+	AfterEach(func() {
+		pubsub.Close()
+		broker.Close()
+	})
+
+	Describe("Subscribe", func() {
+		Context("when T is not a pointer", func() {
+			It("receives a message as T", func() {
+				topic := "room:123"
+				sub, err := kiara.Subscribe[account](pubsub, topic)
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+				ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+				defer cancel()
+				sent := account{Name: "Gura", Age: 9927}
+				err = kiara.Publish(ctx, pubsub, topic, sent)
+				Expect(err).NotTo(HaveOccurred())
+				select {
+				case received := <-sub.Channel():
+					Expect(received).To(Equal(sent))
+				case <-time.After(timeoutExpectedNotToExceed):
+					Fail("timeout")
+				}
+			})
+		})
+
+		Context("when T is a pointer", func() {
+			It("receives a message as T", func() {
+				topic := "room:123"
+				sub, err := kiara.Subscribe[*account](pubsub, topic)
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+				ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+				defer cancel()
+				sent := &account{Name: "Gura", Age: 9927}
+				err = kiara.Publish(ctx, pubsub, topic, sent)
+				Expect(err).NotTo(HaveOccurred())
+				select {
+				case received := <-sub.Channel():
+					Expect(received).To(Equal(sent))
+				case <-time.After(timeoutExpectedNotToExceed):
+					Fail("timeout")
+				}
+			})
+		})
+
+		Context("when the subscription is unsubscribed", func() {
+			It("closes the channel", func() {
+				sub, err := kiara.Subscribe[int](pubsub, "room:123")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sub.Unsubscribe()).NotTo(HaveOccurred())
+				select {
+				case v, ok := <-sub.Channel():
+					Expect(ok).To(BeFalse(), fmt.Sprintf("expected the channel to be closed but got %v", v))
+				case <-time.After(timeoutExpectedNotToExceed):
+					Fail("timeout")
+				}
+			})
+
+			It("can be unsubscribed more than once", func() {
+				sub, err := kiara.Subscribe[int](pubsub, "room:123")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(sub.Unsubscribe()).NotTo(HaveOccurred())
+				Expect(sub.Unsubscribe()).NotTo(HaveOccurred())
+			})
+		})
+
+		Context("when the topic is also subscribed by PubSub.Subscribe", func() {
+			It("sends a message to both subscribers", func() {
+				topic := "room:123"
+				typedSub, err := kiara.Subscribe[int](pubsub, topic)
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(typedSub.Unsubscribe()).NotTo(HaveOccurred()) }()
+				ch := make(chan int, defaultChSize)
+				sub, err := pubsub.Subscribe(topic, ch)
+				Expect(err).NotTo(HaveOccurred())
+				defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+
+				ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+				defer cancel()
+				var sent int = 123
+				err = kiara.Publish(ctx, pubsub, topic, sent)
+				Expect(err).NotTo(HaveOccurred())
+				for i, ch := range []<-chan int{typedSub.Channel(), ch} {
+					select {
+					case received := <-ch:
+						Expect(received).To(Equal(sent))
+					case <-time.After(timeoutExpectedNotToExceed):
+						Fail(fmt.Sprintf("%d: timeout", i))
+					}
+				}
+			})
+		})
+	})
+
+	Describe("SubscribeDelivery", func() {
+		It("receives a message together with its metadata", func() {
+			topic := "room:123"
+			sub, err := kiara.SubscribeDelivery[account](pubsub, topic)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			sent := account{Name: "Gura", Age: 9927}
+			headers := map[string]string{"Correlation-Id": "kfp-001"}
+			err = kiara.Publish(ctx, pubsub, topic, sent, kiara.WithHeaders(headers))
+			Expect(err).NotTo(HaveOccurred())
+			select {
+			case received := <-sub.Channel():
+				Expect(received.Context).NotTo(BeNil())
+				Expect(received.ReceivedAt).NotTo(BeZero())
+				received.Context = nil
+				received.ReceivedAt = time.Time{}
+				Expect(received).To(Equal(kiara.Delivery[account]{Topic: topic, Headers: headers, Value: sent}))
+			case <-time.After(timeoutExpectedNotToExceed):
+				Fail("timeout")
+			}
+		})
+
+		It("gives each subscription its own headers", func() {
+			topic := "room:123"
+			sub1, err := kiara.SubscribeDelivery[account](pubsub, topic)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub1.Unsubscribe()).NotTo(HaveOccurred()) }()
+			sub2, err := kiara.SubscribeDelivery[account](pubsub, topic)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub2.Unsubscribe()).NotTo(HaveOccurred()) }()
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			headers := map[string]string{"Correlation-Id": "kfp-001"}
+			err = kiara.Publish(ctx, pubsub, topic, account{Name: "Gura", Age: 9927}, kiara.WithHeaders(headers))
+			Expect(err).NotTo(HaveOccurred())
+			var received [2]kiara.Delivery[account]
+			for i, sub := range []*kiara.TypedSubscription[kiara.Delivery[account]]{sub1, sub2} {
+				select {
+				case received[i] = <-sub.Channel():
+				case <-time.After(timeoutExpectedNotToExceed):
+					Fail(fmt.Sprintf("%d: timeout", i))
+				}
+			}
+			received[0].Headers["Correlation-Id"] = "modified"
+			Expect(received[1].Headers).To(HaveKeyWithValue("Correlation-Id", "kfp-001"))
+		})
+
+		It("receives each message as a new value when T is a pointer", func() {
+			topic := "room:123"
+			sub, err := kiara.SubscribeDelivery[*account](pubsub, topic)
+			Expect(err).NotTo(HaveOccurred())
+			defer func() { Expect(sub.Unsubscribe()).NotTo(HaveOccurred()) }()
+			ctx, cancel := context.WithTimeout(context.Background(), timeoutExpectedNotToExceed)
+			defer cancel()
+			sent := []*account{{Name: "Gura", Age: 9927}, {Name: "Ame", Age: 20}}
+			for _, a := range sent {
+				err = kiara.Publish(ctx, pubsub, topic, a)
+				Expect(err).NotTo(HaveOccurred())
+			}
+			var received [2]kiara.Delivery[*account]
+			for i := range received {
+				select {
+				case received[i] = <-sub.Channel():
+				case <-time.After(timeoutExpectedNotToExceed):
+					Fail(fmt.Sprintf("%d: timeout", i))
+				}
+			}
+			Expect(received[0].Value).To(Equal(sent[0]))
+			Expect(received[1].Value).To(Equal(sent[1]))
+			Expect(received[0].Value).NotTo(BeIdenticalTo(received[1].Value))
+		})
+	})
+})
@@ -1,22 +1,127 @@
 // Package types provides types and interfaces that are needed to implement backend adapters.
 package types
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	// HeaderReplyTo is a header that holds a topic to which a reply to the message should be sent.
+	// Adapters that support request/reply natively must expose their reply address through this header.
+	HeaderReplyTo = "Kiara-Reply-To"
+
+	// HeaderMessageID is a header that holds an ID that is unique to each message.
+	// kiara.PubSub sets it to every message that it publishes if kiara.WithMessageIDs is given, unless publishers give their own IDs.
+	HeaderMessageID = "Kiara-Message-Id"
+
+	// HeaderExpiresAt is a header that holds the time when the message expires, in nanoseconds since the Unix epoch.
+	// Adapters and kiara.PubSub discard messages that have expired instead of publishing or delivering them.
+	HeaderExpiresAt = "Kiara-Expires-At"
+)
+
+var (
+	// This error is reported through Message.Complete when a message expires before it is published.
+	ErrExpired = errors.New("message expired")
+)
+
 // Message represents a message that is sent over Adapters.
 type Message struct {
 	// Topic is a topic or a channel through which messages are sent.
 	// Restrictions of topics are dependent on the concrete implementation of the Adapter.
 	Topic string
 
+	// Headers are arbitrary key-value pairs attached to the message, such as correlation IDs or content types.
+	// Adapters must carry them to subscribers together with the payload. It may be nil when the message has no headers.
+	Headers map[string]string
+
 	// Payload is the payload of the message.
 	Payload []byte
+
+	// Pattern is a pattern through which the message is delivered.
+	// When Adapters deliver messages that matched a pattern subscribed by PatternAdapter.SubscribePattern,
+	// they must set the pattern here. It must be empty otherwise.
+	Pattern string
+
+	// Result is a channel through which the result of publishing the message is reported
+	// when the publisher waits for it. It is nil when no one waits for the result.
+	// Adapters should not use this directly. Use Complete instead.
+	Result chan<- error
+}
+
+// ExpiresAt returns the time when the message expires.
+// It returns false if the message never expires.
+func (m *Message) ExpiresAt() (time.Time, bool) {
+	v, ok := m.Headers[HeaderExpiresAt]
+	if !ok {
+		return time.Time{}, false
+	}
+	nanos, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		// Messages are never discarded by malformed headers.
+		return time.Time{}, false
+	}
+	return time.Unix(0, nanos), true
+}
+
+// Expired reports whether the message has expired at `now`.
+func (m *Message) Expired(now time.Time) bool {
+	expiresAt, ok := m.ExpiresAt()
+	return ok && !now.Before(expiresAt)
+}
+
+// SetHeader sets a header of the message. See SetHeaders.
+func (m *Message) SetHeader(key, value string) {
+	m.SetHeaders(map[string]string{key: value})
+}
+
+// SetHeaders sets the given headers of the message, overwriting existing ones with the same keys.
+// Headers are replaced with a new map instead of being modified in place, because they may be shared with the publisher
+// or other subscriptions.
+func (m *Message) SetHeaders(headers map[string]string) {
+	merged := make(map[string]string, len(m.Headers)+len(headers))
+	for k, v := range m.Headers {
+		merged[k] = v
+	}
+	for k, v := range headers {
+		merged[k] = v
+	}
+	m.Headers = merged
+}
+
+// Complete reports the result of publishing the message to the publisher if it waits for the result.
+// Adapters must call this exactly once after they finish publishing a message that comes from Pipe.Publish.
+// It returns false if no one waits for the result, in which case Adapters should report a non-nil `err` through Pipe.Errors instead.
+func (m *Message) Complete(err error) bool {
+	if m.Result == nil {
+		return false
+	}
+	select {
+	case m.Result <- err:
+	default:
+		// The result has already been reported.
+	}
+	return true
 }
 
 // Pipe is a pipeline through which kiara.PubSub communicates with Adapters.
 type Pipe struct {
 	// Publish is a messages that are about to be published.
-	// Adapters must watch this channel and send messages from this channel to backend message brokers.
+	// Adapters must watch this channel and send messages from this channel to backend message brokers,
+	// and then report the result of publishing by Message.Complete.
 	Publish <-chan *Message
 
+	// PublishBatch is batches of messages that are about to be published.
+	// kiara.PubSub sends batches through this channel only when the Adapter implements BatchAdapter.
+	// Adapters must handle each message in a batch in the same way as ones from Publish, including reporting the result
+	// by Message.Complete, but they may send a batch to backend message brokers at once.
+	// Adapters must keep the order of messages in a batch, but they need not keep the order between batches and
+	// messages from Publish.
+	PublishBatch <-chan []*Message
+
 	// Delivered is a messages that are sent from backend message brokers.
 	// When messages are sent from Adapter's backend message brokers, Adapters must send them to this channel.
 	// When sending to this channel blocks, Adapters should not wait, discard succeeding messages, and send
@@ -25,9 +130,47 @@ type Pipe struct {
 
 	// Errors are asynchronous erros that occurred in Adapters.
 	// When sending to this channel blocks, Adapters should not wait and discard succeeding errors.
+	// Errors that are related to a specific message should be wrapped with PublishError or DeliveryError.
 	Errors chan<- error
 }
 
+// PublishError is an error that occurred while publishing a message.
+type PublishError struct {
+	// Topic is the topic of the message.
+	Topic string
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *PublishError) Error() string {
+	return fmt.Sprintf("failed to publish a message to %q: %v", e.Topic, e.Err)
+}
+
+func (e *PublishError) Unwrap() error {
+	return e.Err
+}
+
+// DeliveryError is an error that occurred while an Adapter was delivering a message that arrived from its backend.
+type DeliveryError struct {
+	// Topic is the topic of the message.
+	Topic string
+
+	// Payload is the payload of the message. It may be nil when the message could not be received at all.
+	Payload []byte
+
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *DeliveryError) Error() string {
+	return fmt.Sprintf("failed to deliver a message from %q: %v", e.Topic, e.Err)
+}
+
+func (e *DeliveryError) Unwrap() error {
+	return e.Err
+}
+
 // Adapter is an abstract interface to send and receive Messsages.
 type Adapter interface {
 	// Start starts communicating with `kiara.PubSub` through the given Pipe.
@@ -44,6 +187,100 @@ type Adapter interface {
 	Stop()
 }
 
+// PatternAdapter is an Adapter that can subscribe to topics that match a pattern.
+// The syntax of patterns is dependent on the concrete implementation of the Adapter.
+type PatternAdapter interface {
+	Adapter
+
+	// SubscribePattern subscribes topics that match the given pattern.
+	// A message that matches both an exact topic and patterns must be delivered once for each of them.
+	SubscribePattern(pattern string) error
+
+	// UnsubscribePattern unsubscribes a pattern.
+	UnsubscribePattern(pattern string) error
+}
+
+// RequestAdapter is an Adapter that supports request/reply natively.
+// When an Adapter does not implement this, kiara.PubSub sends requests through per-request reply topics.
+type RequestAdapter interface {
+	Adapter
+
+	// Request sends a message and waits for a reply until `ctx` is done.
+	Request(ctx context.Context, msg *Message) (*Message, error)
+}
+
+// BatchAdapter is an Adapter that can publish messages in batches, e.g. by pipelining requests to the backend.
+// When an Adapter does not implement this, kiara.PubSub sends messages of a batch one by one through Pipe.Publish.
+type BatchAdapter interface {
+	Adapter
+
+	// MaxBatchSize returns the maximum number of messages in a batch sent through Pipe.PublishBatch.
+	// kiara.PubSub splits larger batches into ones of this size. It returns 0 if the size is unlimited.
+	MaxBatchSize() int
+}
+
+// DrainAdapter is an Adapter that can stop gracefully.
+// When an Adapter does not implement this, kiara.PubSub only waits until Pipe.Publish becomes empty before stopping it.
+type DrainAdapter interface {
+	Adapter
+
+	// Drain publishes all messages remaining in Pipe.Publish and Pipe.PublishBatch, stops receiving new messages from the backend,
+	// and sends messages that have already been received to Pipe.Delivered.
+	// It returns once it finishes or `ctx` is done. kiara.PubSub does not send any messages to Pipe.Publish
+	// after calling Drain, and calls Stop after Drain returns.
+	Drain(ctx context.Context) error
+}
+
+// StatsAdapter is an Adapter that collects statistics of messages it handles.
+type StatsAdapter interface {
+	Adapter
+
+	// Stats returns a snapshot of the statistics collected since the adapter is created.
+	Stats() AdapterStats
+}
+
+// AdapterStats is a snapshot of statistics collected by a StatsAdapter.
+type AdapterStats struct {
+	// Published is the number of messages sent to the backend.
+	Published uint64
+
+	// PublishFailures is the number of messages that could not be sent to the backend.
+	PublishFailures uint64
+
+	// Delivered is the number of messages sent to Pipe.Delivered.
+	Delivered uint64
+
+	// Dropped is the number of messages discarded because Pipe.Delivered was full or the backend could not catch up with them.
+	Dropped uint64
+
+	// DecodeFailures is the number of messages that arrived from the backend but could not be decoded.
+	DecodeFailures uint64
+
+	// Expired is the number of messages discarded because they expired before being published or delivered.
+	Expired uint64
+}
+
+// ScheduleStore stores messages that kiara.PubSub publishes later by PublishAt or PublishAfter.
+// A store may be shared by more than one PubSub, e.g. by all processes of a service, in which case each message
+// must be returned by Due to only one of them. Implementations must be safe for concurrent use.
+//
+// Scheduled messages are published at most once: a message returned by Due is no longer in the store, so it is lost if
+// the process exits before publishing it or the underlying message broker fails to publish it. Such failures are
+// reported through kiara.PubSub.Errors().
+type ScheduleStore interface {
+	// Add stores a message that should be published at `at`.
+	// Only Topic, Headers and Payload of the message need to be stored.
+	Add(ctx context.Context, msg *Message, at time.Time) error
+
+	// Due removes messages that should be published by `now` from the store and returns them in order of their scheduled time.
+	// It may return messages that have already been removed together with an error.
+	Due(ctx context.Context, now time.Time) ([]*Message, error)
+
+	// Next returns the earliest time at which a stored message should be published.
+	// It returns false if the store is empty.
+	Next(ctx context.Context) (time.Time, bool, error)
+}
+
 // Codec converts an arbitrary object into a byte slice.
 type Codec interface {
 	// Marshal converts `v` into a byte slice.